@@ -0,0 +1,139 @@
+// Package admin serves the health, readiness and liveness endpoints used by
+// Kubernetes probes on a dedicated HTTP port.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Check reports whether a component is healthy, returning nil when it is
+type Check func(ctx context.Context) error
+
+// checkTimeout bounds the time spent running the checks of a single probe
+const checkTimeout = 5 * time.Second
+
+// namedCheck is a registered Check
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Server is the admin HTTP server. /readyz runs the readiness checks, /livez
+// runs the liveness checks and /healthz runs both. A probe answers 200 when
+// all its checks pass and 503 otherwise, with the result of every check in
+// a JSON body.
+type Server struct {
+	logger *zap.Logger
+	mux    *http.ServeMux
+	server *http.Server
+
+	mu        sync.Mutex
+	readiness []namedCheck
+	liveness  []namedCheck
+}
+
+// New creates an admin server listening on addr once started
+func New(addr string, logger *zap.Logger) *Server {
+	s := &Server{
+		logger: logger,
+		mux:    http.NewServeMux(),
+	}
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	s.mux.HandleFunc("GET /healthz", s.probe(func() []namedCheck {
+		return append(s.checks(&s.readiness), s.checks(&s.liveness)...)
+	}))
+	s.mux.HandleFunc("GET /readyz", s.probe(func() []namedCheck { return s.checks(&s.readiness) }))
+	s.mux.HandleFunc("GET /livez", s.probe(func() []namedCheck { return s.checks(&s.liveness) }))
+	return s
+}
+
+// AddReadinessCheck registers a check that must pass for the service to
+// receive traffic
+func (s *Server) AddReadinessCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readiness = append(s.readiness, namedCheck{name: name, check: check})
+}
+
+// AddLivenessCheck registers a check whose failure means the process must
+// be restarted
+func (s *Server) AddLivenessCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.liveness = append(s.liveness, namedCheck{name: name, check: check})
+}
+
+// Handle registers an additional handler on the admin port
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start listens on the configured address and serves requests in the
+// background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("Admin server listening", zap.String("addr", listener.Addr().String()))
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Admin server failed", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the server, waiting for the active requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) checks(list *[]namedCheck) []namedCheck {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]namedCheck(nil), *list...)
+}
+
+// probeResponse is the JSON body of a probe
+type probeResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// probe returns a handler running the checks returned by checks
+func (s *Server) probe(checks func() []namedCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		resp := probeResponse{Status: "ok", Checks: make(map[string]string)}
+		code := http.StatusOK
+		for _, c := range checks() {
+			if err := c.check(ctx); err != nil {
+				resp.Checks[c.name] = err.Error()
+				resp.Status = "failed"
+				code = http.StatusServiceUnavailable
+				continue
+			}
+			resp.Checks[c.name] = "ok"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestProbes(t *testing.T) {
+	tests := []struct {
+		name       string
+		readiness  error
+		liveness   error
+		path       string
+		wantCode   int
+		wantStatus string
+		wantChecks map[string]string
+	}{
+		{
+			name:       "ready",
+			path:       "/readyz",
+			wantCode:   http.StatusOK,
+			wantStatus: "ok",
+			wantChecks: map[string]string{"producer": "ok"},
+		},
+		{
+			name:       "not ready",
+			readiness:  errors.New("producer not created"),
+			path:       "/readyz",
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "failed",
+			wantChecks: map[string]string{"producer": "producer not created"},
+		},
+		{
+			name:       "not ready is still live",
+			readiness:  errors.New("producer not created"),
+			path:       "/livez",
+			wantCode:   http.StatusOK,
+			wantStatus: "ok",
+			wantChecks: map[string]string{"consume_loop": "ok"},
+		},
+		{
+			name:       "healthy",
+			path:       "/healthz",
+			wantCode:   http.StatusOK,
+			wantStatus: "ok",
+			wantChecks: map[string]string{"producer": "ok", "consume_loop": "ok"},
+		},
+		{
+			name:       "stalled",
+			liveness:   errors.New("no progress for 1m0s"),
+			path:       "/healthz",
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "failed",
+			wantChecks: map[string]string{"producer": "ok", "consume_loop": "no progress for 1m0s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New("127.0.0.1:0", zap.NewNop())
+			s.AddReadinessCheck("producer", func(context.Context) error { return tt.readiness })
+			s.AddLivenessCheck("consume_loop", func(context.Context) error { return tt.liveness })
+
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			var resp probeResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", resp.Status, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(resp.Checks, tt.wantChecks) {
+				t.Errorf("checks = %v, want %v", resp.Checks, tt.wantChecks)
+			}
+		})
+	}
+}
+
+func TestProbeMethodNotAllowed(t *testing.T) {
+	s := New("127.0.0.1:0", zap.NewNop())
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/readyz", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /readyz = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,65 @@
+// Command asyncapi-gen generates Go message types, channel constants and
+// typed publish/subscribe helpers from an AsyncAPI 3 document, so that the
+// spec stays the source of truth for the payloads. It is meant to be run with
+// go generate:
+//
+//	//go:generate go run ../cmd/asyncapi-gen -spec ../async-spec.yml -out events_gen.go -package events
+//
+// Every message payload becomes a struct with json and avro tags together
+// with its Avro schema definition and a codec constructor. Every send
+// operation gets a producer constructor and every receive operation a
+// subscribe function, both built on the pulsarotel traced producer and
+// consumer and defaulting to the topic of the channel.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+)
+
+const defaultPulsarotelImport = "github.com/eduardofesilva/async-eda-otel-workshop/app/pulsarotel"
+
+func main() {
+	specPath := flag.String("spec", "async-spec.yml", "path of the AsyncAPI document")
+	out := flag.String("out", "", "output file, standard output when empty")
+	pkg := flag.String("package", "events", "package name of the generated file")
+	pulsarotelImport := flag.String("pulsarotel", defaultPulsarotelImport, "import path of the pulsarotel package")
+	flag.Parse()
+
+	if err := run(*specPath, *out, *pkg, *pulsarotelImport); err != nil {
+		fmt.Fprintln(os.Stderr, "asyncapi-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(specPath, out, pkg, pulsarotelImport string) error {
+	doc, err := readDocument(specPath)
+	if err != nil {
+		return err
+	}
+	m, err := buildModel(doc, pkg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", specPath, err)
+	}
+	m.Source = filepath.Base(specPath)
+	m.PulsarotelImport = pulsarotelImport
+
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, m); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("generated invalid Go code: %w\n%s", err, buf.Bytes())
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0o644)
+}
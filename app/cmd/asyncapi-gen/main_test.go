@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestGeneratedEventsUpToDate regenerates the events package from
+// async-spec.yml and compares it with the checked in events_gen.go
+func TestGeneratedEventsUpToDate(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "events_gen.go")
+	if err := run("../../async-spec.yml", out, "events", defaultPulsarotelImport); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("../../events/events_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("events/events_gen.go differs from the generator output, run go generate ./events:\n%s", got)
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// model is what the template renders
+type model struct {
+	Package          string
+	Source           string
+	PulsarotelImport string
+
+	Channels   []*channel
+	Messages   []*message
+	Structs    []*structType
+	Operations []*operation
+}
+
+type channel struct {
+	Key         string
+	GoName      string
+	Address     string
+	Description string
+	// Topic is the fully qualified topic name built from the Pulsar
+	// bindings, empty when the tenant or namespace is unknown
+	Topic string
+}
+
+type message struct {
+	Key         string
+	GoName      string
+	Channel     *channel
+	ContentType string
+	Struct      *structType
+	AvroSchema  string
+	// JSONSchema is the payload schema with its references inlined
+	JSONSchema string
+}
+
+type structType struct {
+	GoName string
+	Doc    string
+	Fields []field
+}
+
+type field struct {
+	GoName string
+	Name   string
+	Type   string
+	Doc    string
+	// Optional fields are left out of the required properties and may be
+	// missing from the payload
+	Optional bool
+}
+
+type operation struct {
+	ID      string
+	GoName  string
+	Action  string
+	Summary string
+	Channel *channel
+	Message *message
+}
+
+// Send reports whether the application publishes the messages of the operation
+func (o *operation) Send() bool {
+	return o.Action == "send"
+}
+
+// buildModel walks the channels and operations of doc
+func buildModel(doc *document, pkg string) (*model, error) {
+	m := &model{Package: pkg}
+	tenant := serverTenant(doc)
+
+	messagesByRef := make(map[string]*message)
+	channelsByRef := make(map[string]*channel)
+
+	channels := objectField(doc.root, "channels")
+	for _, key := range orderedKeys(channels) {
+		node, err := doc.resolve(channels[key])
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", key, err)
+		}
+		ch := &channel{
+			Key:         key,
+			GoName:      goName(key),
+			Address:     stringField(node, "address"),
+			Description: stringField(node, "description"),
+		}
+		if ch.Address == "" {
+			ch.Address = key
+		}
+		if strings.ContainsAny(ch.Address, "{}") {
+			return nil, fmt.Errorf("channel %s: parameterized addresses are not supported", key)
+		}
+		if pulsar := objectField(objectField(node, "bindings"), "pulsar"); pulsar != nil && tenant != "" {
+			namespace := stringField(pulsar, "namespace")
+			persistence := stringField(pulsar, "persistence")
+			if persistence == "" {
+				persistence = "persistent"
+			}
+			if namespace != "" {
+				ch.Topic = fmt.Sprintf("%s://%s/%s/%s", persistence, tenant, namespace, ch.Address)
+			}
+		}
+		m.Channels = append(m.Channels, ch)
+		channelRef := "#/channels/" + escapePointer(key)
+		channelsByRef[channelRef] = ch
+
+		messages := objectField(node, "messages")
+		for _, msgKey := range orderedKeys(messages) {
+			msgRef := channelRef + "/messages/" + escapePointer(msgKey)
+			// Channels sharing a component message share its Go type
+			if msg, ok := messagesByRef[refOf(messages[msgKey])]; ok {
+				messagesByRef[msgRef] = msg
+				continue
+			}
+			msgNode, err := doc.resolve(messages[msgKey])
+			if err != nil {
+				return nil, fmt.Errorf("message %s of channel %s: %w", msgKey, key, err)
+			}
+			name := stringField(msgNode, "name")
+			if name == "" {
+				name = msgKey
+			}
+			msg := &message{
+				Key:         msgKey,
+				GoName:      goName(name),
+				Channel:     ch,
+				ContentType: stringField(msgNode, "contentType"),
+			}
+			payload, err := doc.resolve(msgNode["payload"])
+			if err != nil {
+				return nil, fmt.Errorf("payload of message %s: %w", msgKey, err)
+			}
+			comment := fmt.Sprintf("%s is the payload of the %s message on the %s channel", msg.GoName, name, ch.Address)
+			avro, err := m.addStruct(doc, msg.GoName, comment, payload)
+			if err != nil {
+				return nil, fmt.Errorf("payload of message %s: %w", msgKey, err)
+			}
+			msg.Struct = m.Structs[len(m.Structs)-1]
+			schema, err := json.MarshalIndent(avro, "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			msg.AvroSchema = string(schema)
+			inlined, err := doc.inline(msgNode["payload"])
+			if err != nil {
+				return nil, fmt.Errorf("payload of message %s: %w", msgKey, err)
+			}
+			if schema, err = json.MarshalIndent(inlined, "", "  "); err != nil {
+				return nil, err
+			}
+			msg.JSONSchema = string(schema)
+			m.Messages = append(m.Messages, msg)
+			messagesByRef[msgRef] = msg
+			if ref := refOf(messages[msgKey]); ref != "" {
+				messagesByRef[ref] = msg
+			}
+		}
+	}
+
+	operations := objectField(doc.root, "operations")
+	for _, id := range orderedKeys(operations) {
+		node, err := doc.resolve(operations[id])
+		if err != nil {
+			return nil, fmt.Errorf("operation %s: %w", id, err)
+		}
+		op := &operation{
+			ID:      id,
+			GoName:  goName(id),
+			Action:  stringField(node, "action"),
+			Summary: stringField(node, "summary"),
+		}
+		if op.Action != "send" && op.Action != "receive" {
+			return nil, fmt.Errorf("operation %s: action %q must be send or receive", id, op.Action)
+		}
+		if op.Channel = channelsByRef[refOf(node["channel"])]; op.Channel == nil {
+			return nil, fmt.Errorf("operation %s: channel %q not found", id, refOf(node["channel"]))
+		}
+
+		refs, _ := node["messages"].([]any)
+		switch len(refs) {
+		case 0:
+			for _, msg := range m.Messages {
+				if msg.Channel == op.Channel {
+					if op.Message != nil {
+						return nil, fmt.Errorf("operation %s: channel %s has several messages, list the one to use", id, op.Channel.Key)
+					}
+					op.Message = msg
+				}
+			}
+		case 1:
+			op.Message = messagesByRef[refOf(refs[0])]
+		default:
+			return nil, fmt.Errorf("operation %s: only one message per operation is supported", id)
+		}
+		if op.Message == nil {
+			return nil, fmt.Errorf("operation %s: message not found in channel %s", id, op.Channel.Key)
+		}
+		m.Operations = append(m.Operations, op)
+	}
+
+	if err := checkUniqueNames(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// addStruct adds the Go struct for the object schema and its nested objects,
+// and returns the matching Avro record
+func (m *model) addStruct(doc *document, name, comment string, schema map[string]any) (*avroRecord, error) {
+	if t := stringField(schema, "type"); t != "object" {
+		return nil, fmt.Errorf("%s: payload type %q must be object", name, t)
+	}
+	st := &structType{GoName: name, Doc: comment}
+	var avroFields []avroField
+
+	properties := objectField(schema, "properties")
+	required, _ := schema["required"].([]any)
+	for _, prop := range orderedPropertyKeys(schema, properties) {
+		propSchema, err := doc.resolve(properties[prop])
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", name, prop, err)
+		}
+		goType, avroType, err := m.fieldType(doc, name+goName(prop), propSchema)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", name, prop, err)
+		}
+		f := field{
+			GoName:   goName(prop),
+			Name:     prop,
+			Type:     goType,
+			Doc:      stringField(propSchema, "description"),
+			Optional: !slices.Contains(required, any(prop)),
+		}
+		af := avroField{Name: prop, Type: avroType}
+		if f.Optional {
+			// Payloads written before the property existed still decode,
+			// a nil slice already stands for a missing array
+			if !strings.HasPrefix(goType, "[]") {
+				f.Type = "*" + goType
+			}
+			af.Type = []any{"null", avroType}
+			af.Default = json.RawMessage("null")
+		}
+		st.Fields = append(st.Fields, f)
+		avroFields = append(avroFields, af)
+	}
+
+	m.Structs = append(m.Structs, st)
+	return &avroRecord{
+		Type:      "record",
+		Name:      name,
+		Namespace: m.Package,
+		Fields:    avroFields,
+	}, nil
+}
+
+// avroRecord is the Avro definition of a struct
+type avroRecord struct {
+	Type      string      `json:"type"`
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace"`
+	Fields    []avroField `json:"fields"`
+}
+
+type avroField struct {
+	Name    string          `json:"name"`
+	Type    any             `json:"type"`
+	Default json.RawMessage `json:"default,omitempty"`
+}
+
+// fieldType returns the Go and Avro types of a property schema, adding a
+// struct named name for nested objects
+func (m *model) fieldType(doc *document, name string, schema map[string]any) (string, any, error) {
+	switch t := stringField(schema, "type"); t {
+	case "string":
+		return "string", "string", nil
+	case "boolean":
+		return "bool", "boolean", nil
+	case "integer":
+		if stringField(schema, "format") == "int32" {
+			return "int32", "int", nil
+		}
+		return "int64", "long", nil
+	case "number":
+		if stringField(schema, "format") == "float" {
+			return "float32", "float", nil
+		}
+		return "float64", "double", nil
+	case "array":
+		items, err := doc.resolve(schema["items"])
+		if err != nil {
+			return "", nil, fmt.Errorf("items: %w", err)
+		}
+		goType, avroType, err := m.fieldType(doc, name+"Item", items)
+		if err != nil {
+			return "", nil, err
+		}
+		return "[]" + goType, map[string]any{"type": "array", "items": avroType}, nil
+	case "object":
+		record, err := m.addStruct(doc, name, fmt.Sprintf("%s is a nested object", name), schema)
+		if err != nil {
+			return "", nil, err
+		}
+		return name, record, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported type %q", t)
+	}
+}
+
+// checkUniqueNames rejects specs whose generated Go identifiers would collide
+func checkUniqueNames(m *model) error {
+	seen := make(map[string]string)
+	var err error
+	add := func(name, what string) {
+		if other, ok := seen[name]; ok {
+			if err == nil {
+				err = fmt.Errorf("%s and %s both map to the Go identifier %s", other, what, name)
+			}
+			return
+		}
+		seen[name] = what
+	}
+	for _, st := range m.Structs {
+		add(st.GoName, "type "+st.GoName)
+	}
+	for _, ch := range m.Channels {
+		add("Channel"+ch.GoName, "channel "+ch.Key)
+		if ch.Topic != "" {
+			add("Topic"+ch.GoName, "topic of channel "+ch.Key)
+		}
+	}
+	for _, msg := range m.Messages {
+		for _, format := range []string{"%sSchema", "%sJSONSchema", "New%sContract", "New%sCodec"} {
+			add(fmt.Sprintf(format, msg.GoName), "message "+msg.Key)
+		}
+	}
+	for _, op := range m.Operations {
+		if op.Send() {
+			add("New"+op.GoName+"Producer", "operation "+op.ID)
+		} else {
+			add("Subscribe"+op.GoName, "operation "+op.ID)
+		}
+	}
+	return err
+}
+
+// serverTenant returns the Pulsar tenant of the first server declaring one
+func serverTenant(doc *document) string {
+	servers := objectField(doc.root, "servers")
+	for _, key := range orderedKeys(servers) {
+		server, err := doc.resolve(servers[key])
+		if err != nil {
+			continue
+		}
+		if tenant := stringField(objectField(objectField(server, "bindings"), "pulsar"), "tenant"); tenant != "" {
+			return tenant
+		}
+	}
+	return ""
+}
+
+// orderedPropertyKeys lists the required properties first, then the other
+// properties, both in the order of the document
+func orderedPropertyKeys(schema, properties map[string]any) []string {
+	var keys []string
+	required, _ := schema["required"].([]any)
+	for _, r := range required {
+		if name, ok := r.(string); ok {
+			if _, ok := properties[name]; ok && !slices.Contains(keys, name) {
+				keys = append(keys, name)
+			}
+		}
+	}
+	for _, key := range orderedKeys(properties) {
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// initialisms are written in upper case in Go identifiers
+var initialisms = []string{"api", "cpu", "http", "https", "id", "ip", "json", "tcp", "tls", "ttl", "uri", "url", "uuid", "xml"}
+
+// goName turns a spec key such as message_id or my-topic into an exported
+// Go identifier such as MessageID or MyTopic
+func goName(key string) string {
+	parts := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, part := range parts {
+		if slices.Contains(initialisms, strings.ToLower(part)) {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	name := b.String()
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testModel builds the model of the AsyncAPI document spec
+func testModel(t *testing.T, spec string) (*model, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "spec.yml")
+	if err := os.WriteFile(path, []byte(spec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := readDocument(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buildModel(doc, "events")
+}
+
+const orderSpec = `asyncapi: 3.0.0
+channels:
+  orders:
+    messages:
+      order:
+        name: Order
+        payload:
+          type: object
+          required: [id]
+          properties:
+            id:
+              type: string
+            note:
+              type: string
+            tags:
+              type: array
+              items:
+                type: string
+            %s:
+              type: object
+              properties:
+                name:
+                  type: string
+operations:
+  publishOrder:
+    action: send
+    channel:
+      $ref: '#/channels/orders'
+`
+
+func TestOptionalPropertiesAreNullable(t *testing.T) {
+	m, err := testModel(t, strings.Replace(orderSpec, "%s", "customer", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"ID": "string", "Note": "*string", "Tags": "[]string", "Customer": "*OrderCustomer"}
+	order := m.Messages[0].Struct
+	for _, f := range order.Fields {
+		if f.Type != want[f.GoName] {
+			t.Errorf("field %s has type %s, want %s", f.GoName, f.Type, want[f.GoName])
+		}
+		if f.Optional != (f.Name != "id") {
+			t.Errorf("field %s optional = %t", f.GoName, f.Optional)
+		}
+	}
+
+	var record struct {
+		Fields []map[string]json.RawMessage `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(m.Messages[0].AvroSchema), &record); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range record.Fields {
+		name, typ := string(f["name"]), string(f["type"])
+		var union []json.RawMessage
+		nullable := json.Unmarshal(f["type"], &union) == nil && len(union) == 2 && string(union[0]) == `"null"`
+		defaultValue, hasDefault := f["default"]
+		if name == `"id"` {
+			if nullable || hasDefault {
+				t.Errorf("required field id = %s, want a plain string without default", typ)
+			}
+			continue
+		}
+		if !nullable || string(defaultValue) != "null" {
+			t.Errorf("optional field %s = %s with default %s, want a null union defaulting to null", name, typ, defaultValue)
+		}
+	}
+}
+
+func TestCollidingGeneratedNames(t *testing.T) {
+	// The nested object OrderSchema collides with the Avro schema constant
+	// of the Order message
+	_, err := testModel(t, strings.Replace(orderSpec, "%s", "schema", 1))
+	if err == nil || !strings.Contains(err.Error(), "OrderSchema") {
+		t.Errorf("buildModel error = %v, want a collision on OrderSchema", err)
+	}
+}
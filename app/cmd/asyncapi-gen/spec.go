@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// document is a parsed AsyncAPI document, kept as generic YAML nodes so that
+// $ref pointers can be resolved anywhere in it
+type document struct {
+	root map[string]any
+}
+
+// readDocument parses the AsyncAPI 3 document at path
+func readDocument(path string) (*document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(node.Content) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	root, ok := convert(node.Content[0]).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a YAML mapping", path)
+	}
+	version, _ := root["asyncapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("%s: unsupported AsyncAPI version %q, expected 3.x", path, version)
+	}
+	return &document{root: root}, nil
+}
+
+// keysField holds the keys of a mapping in document order, since the
+// generated code follows the order of the spec
+const keysField = "\x00keys"
+
+// convert turns a YAML node into maps, slices and scalars, recording the key
+// order of every mapping under keysField
+func convert(node *yaml.Node) any {
+	switch node.Kind {
+	case yaml.MappingNode:
+		m := make(map[string]any, len(node.Content)/2+1)
+		var keys []string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if _, ok := m[key]; !ok {
+				keys = append(keys, key)
+			}
+			m[key] = convert(node.Content[i+1])
+		}
+		m[keysField] = keys
+		return m
+	case yaml.SequenceNode:
+		s := make([]any, 0, len(node.Content))
+		for _, item := range node.Content {
+			s = append(s, convert(item))
+		}
+		return s
+	case yaml.AliasNode:
+		return convert(node.Alias)
+	default:
+		var v any
+		if err := node.Decode(&v); err != nil {
+			return node.Value
+		}
+		return v
+	}
+}
+
+// orderedKeys returns the keys of a mapping in document order
+func orderedKeys(m map[string]any) []string {
+	keys, _ := m[keysField].([]string)
+	return keys
+}
+
+// lookup returns the node at the local JSON pointer ref, such as
+// #/channels/my-topic
+func (d *document) lookup(ref string) (any, error) {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q, only local references are resolved", ref)
+	}
+	var node any = d.root
+	for _, token := range strings.Split(pointer, "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("$ref %q does not resolve", ref)
+		}
+		if node, ok = m[token]; !ok {
+			return nil, fmt.Errorf("$ref %q does not resolve", ref)
+		}
+	}
+	return node, nil
+}
+
+// resolve follows the $ref chain of node and returns the referenced object
+func (d *document) resolve(node any) (map[string]any, error) {
+	for range 32 {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected an object, got %T", node)
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m, nil
+		}
+		var err error
+		if node, err = d.lookup(ref); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("$ref chain too long")
+}
+
+// inline returns a copy of a schema node with its $ref pointers replaced by
+// the referenced nodes and without the key order bookkeeping, so that it can
+// be marshaled as a standalone JSON Schema
+func (d *document) inline(node any) (any, error) {
+	return d.inlineDepth(node, 0)
+}
+
+func (d *document) inlineDepth(node any, depth int) (any, error) {
+	if depth > 64 {
+		return nil, fmt.Errorf("schema too deep, recursive schemas are not supported")
+	}
+	switch v := node.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			target, err := d.lookup(ref)
+			if err != nil {
+				return nil, err
+			}
+			return d.inlineDepth(target, depth+1)
+		}
+		out := make(map[string]any, len(v))
+		for _, key := range orderedKeys(v) {
+			value, err := d.inlineDepth(v[key], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = value
+		}
+		return out, nil
+	case []any:
+		out := make([]any, 0, len(v))
+		for _, item := range v {
+			value, err := d.inlineDepth(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, value)
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// refOf returns the $ref of node, or an empty string
+func refOf(node any) string {
+	m, _ := node.(map[string]any)
+	ref, _ := m["$ref"].(string)
+	return ref
+}
+
+// escapePointer escapes a key for use as a JSON pointer token
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// stringField returns the string value of key in m
+func stringField(m map[string]any, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// objectField returns the object value of key in m
+func objectField(m map[string]any, key string) map[string]any {
+	o, _ := m[key].(map[string]any)
+	return o
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var fileTemplate = template.Must(template.New("file").Funcs(template.FuncMap{
+	"rawString": rawString,
+	"topic":     topicExpr,
+}).Parse(`// Code generated by asyncapi-gen from {{.Source}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- if .Operations}}
+	"context"
+{{- end}}
+{{- if .Messages}}
+	"fmt"
+{{- end}}
+{{if .Operations}}
+	"github.com/apache/pulsar-client-go/pulsar"
+{{- end}}
+{{- if .Messages}}
+	"{{.PulsarotelImport}}"
+{{- end}}
+)
+
+{{- if .Channels}}
+
+// Channel addresses declared in {{.Source}}
+const (
+{{- range .Channels}}
+	// Channel{{.GoName}} is the address of the {{.Key}} channel{{if .Description}}: {{.Description}}{{end}}
+	Channel{{.GoName}} = {{printf "%q" .Address}}
+{{- end}}
+)
+{{- end}}
+
+{{- range .Channels}}
+{{- if .Topic}}
+
+// Topic{{.GoName}} is the fully qualified topic of the {{.Key}} channel, built
+// from its Pulsar bindings
+const Topic{{.GoName}} = {{printf "%q" .Topic}}
+{{- end}}
+{{- end}}
+
+{{- range .Structs}}
+
+// {{.Doc}}
+type {{.GoName}} struct {
+{{- range .Fields}}
+{{- if .Doc}}
+	// {{.GoName}} {{.Doc}}
+{{- end}}
+	{{.GoName}} {{.Type}} ` + "`" + `json:"{{.Name}}{{if .Optional}},omitempty{{end}}" avro:"{{.Name}}"` + "`" + `
+{{- end}}
+}
+{{- end}}
+
+{{- range .Messages}}
+
+// {{.GoName}}Schema is the Avro definition of {{.GoName}}. Pulsar uses it for
+// both its JSON and Avro schemas, and the protobuf codec derives its message
+// from it.
+const {{.GoName}}Schema = {{rawString .AvroSchema}}
+
+// {{.GoName}}JSONSchema is the JSON Schema of {{.GoName}} payloads declared in
+// the spec, used to validate them at runtime
+const {{.GoName}}JSONSchema = {{rawString .JSONSchema}}
+
+// New{{.GoName}}Contract returns the contract validating {{.GoName}} payloads
+// against {{.GoName}}JSONSchema
+func New{{.GoName}}Contract(strict bool) (*pulsarotel.Contract, error) {
+	return pulsarotel.NewContract({{printf "%q" .GoName}}, {{.GoName}}JSONSchema, strict)
+}
+
+// New{{.GoName}}Codec returns the json, avro or protobuf codec of {{.GoName}} payloads
+func New{{.GoName}}Codec(name string) (pulsarotel.Codec[{{.GoName}}], error) {
+	switch name {
+	case pulsarotel.CodecJSON:
+		return pulsarotel.NewJSONCodec[{{.GoName}}]({{.GoName}}Schema)
+	case pulsarotel.CodecAvro:
+		return pulsarotel.NewAvroCodec[{{.GoName}}]({{.GoName}}Schema)
+	case pulsarotel.CodecProtobuf:
+		return pulsarotel.NewProtoRecordCodec[{{.GoName}}]({{.GoName}}Schema)
+	default:
+		return nil, fmt.Errorf("unsupported codec %q for {{.GoName}}", name)
+	}
+}
+{{- end}}
+
+{{- range .Operations}}
+{{- if .Send}}
+
+// New{{.GoName}}Producer creates the producer of the {{.ID}} operation{{if .Summary}}: {{.Summary}}{{end}}
+// The topic defaults to the {{.Channel.Key}} channel and the schema is the one of codec.
+func New{{.GoName}}Producer(ctx context.Context, tel *pulsarotel.Telemetry, client pulsar.Client, opts pulsar.ProducerOptions,
+	codec pulsarotel.Codec[{{.Message.GoName}}], topts ...pulsarotel.TypedOption) (*pulsarotel.TypedProducer[{{.Message.GoName}}], error) {
+	if opts.Topic == "" {
+		opts.Topic = {{topic .Channel}}
+	}
+	opts.Schema = codec.Schema()
+	producer, err := tel.CreateProducer(ctx, client, opts)
+	if err != nil {
+		return nil, err
+	}
+	return pulsarotel.NewTypedProducer(producer, codec, topts...), nil
+}
+{{- else}}
+
+// Subscribe{{.GoName}} creates the consumer of the {{.ID}} operation{{if .Summary}}: {{.Summary}}{{end}}
+// The topic defaults to the {{.Channel.Key}} channel and the schema is the one
+// of codec. Run the consumer with a pulsarotel.DecodeHandler using codec.
+func Subscribe{{.GoName}}(ctx context.Context, tel *pulsarotel.Telemetry, client pulsar.Client, opts pulsar.ConsumerOptions,
+	codec pulsarotel.Codec[{{.Message.GoName}}], copts ...pulsarotel.ConsumerOption) (*pulsarotel.TracedConsumer, error) {
+	if opts.Topic == "" && len(opts.Topics) == 0 && opts.TopicsPattern == "" {
+		opts.Topic = {{topic .Channel}}
+	}
+	opts.Schema = codec.Schema()
+	return tel.Subscribe(ctx, client, opts, copts...)
+}
+{{- end}}
+{{- end}}
+`))
+
+// rawString quotes s as a raw string literal when possible
+func rawString(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+// topicExpr returns the constant naming the topic of ch
+func topicExpr(ch *channel) string {
+	if ch.Topic != "" {
+		return "Topic" + ch.GoName
+	}
+	return "Channel" + ch.GoName
+}
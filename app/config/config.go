@@ -0,0 +1,651 @@
+// Package config loads the application configuration from an optional YAML
+// file, applies environment variable overrides and validates the result.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eduardofesilva/async-eda-otel-workshop/app/pulsarotel"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete application configuration
+type Config struct {
+	Service   ServiceConfig   `yaml:"service"`
+	Pulsar    PulsarConfig    `yaml:"pulsar"`
+	Producer  ProducerConfig  `yaml:"producer"`
+	Consumer  ConsumerConfig  `yaml:"consumer"`
+	Telemetry TelemetryConfig `yaml:"telemetry"`
+	Admin     AdminConfig     `yaml:"admin"`
+}
+
+// ServiceConfig describes the service in the telemetry resource and the
+// roles it runs
+type ServiceConfig struct {
+	Name            string        `yaml:"name"`
+	Version         string        `yaml:"version"`
+	Environment     string        `yaml:"environment"`
+	Mode            string        `yaml:"mode"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// PulsarConfig holds the Pulsar client settings
+type PulsarConfig struct {
+	URL               string        `yaml:"url"`
+	AuthToken         string        `yaml:"auth_token"`
+	AuthTokenFile     string        `yaml:"auth_token_file"`
+	OAuth2            OAuth2Config  `yaml:"oauth2"`
+	Topic             string        `yaml:"topic"`
+	OperationTimeout  time.Duration `yaml:"operation_timeout"`
+	ConnectionTimeout time.Duration `yaml:"connection_timeout"`
+	AdminURL          string        `yaml:"admin_url"`
+	Codec             string        `yaml:"codec"`
+	Contract          string        `yaml:"contract"`
+	TLS               TLSConfig     `yaml:"tls"`
+}
+
+// OAuth2Config holds the settings of the OAuth2 client credentials
+// authentication, enabled by PrivateKeyFile
+type OAuth2Config struct {
+	IssuerURL      string `yaml:"issuer_url"`
+	Audience       string `yaml:"audience"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	Scope          string `yaml:"scope"`
+}
+
+// TLSConfig holds the TLS settings of pulsar+ssl:// connections. The client
+// certificate and key enable mutual TLS authentication.
+type TLSConfig struct {
+	TrustCertsFile   string        `yaml:"trust_certs_file"`
+	ValidateHostname bool          `yaml:"validate_hostname"`
+	AllowInsecure    bool          `yaml:"allow_insecure"`
+	CertFile         string        `yaml:"cert_file"`
+	KeyFile          string        `yaml:"key_file"`
+	ReloadInterval   time.Duration `yaml:"reload_interval"`
+}
+
+// ProducerConfig holds the settings of the demo producer
+type ProducerConfig struct {
+	Name     string            `yaml:"name"`
+	Interval time.Duration     `yaml:"interval"`
+	Baggage  map[string]string `yaml:"baggage"`
+	Load     LoadConfig        `yaml:"load"`
+}
+
+// LoadConfig holds the load profile of the producer. A positive rate replaces
+// the message sent every interval by a load generator.
+type LoadConfig struct {
+	Rate                float64       `yaml:"rate"`
+	RampUp              time.Duration `yaml:"ramp_up"`
+	RampDown            time.Duration `yaml:"ramp_down"`
+	BurstRate           float64       `yaml:"burst_rate"`
+	BurstInterval       time.Duration `yaml:"burst_interval"`
+	BurstDuration       time.Duration `yaml:"burst_duration"`
+	PayloadDistribution string        `yaml:"payload_distribution"`
+	PayloadMin          int           `yaml:"payload_min"`
+	PayloadMax          int           `yaml:"payload_max"`
+	Keys                int           `yaml:"keys"`
+	Duration            time.Duration `yaml:"duration"`
+	Count               int           `yaml:"count"`
+	Workers             int           `yaml:"workers"`
+}
+
+// Profile returns the load profile of the generator
+func (l LoadConfig) Profile() pulsarotel.LoadProfile {
+	return pulsarotel.LoadProfile{
+		Rate:          l.Rate,
+		RampUp:        l.RampUp,
+		RampDown:      l.RampDown,
+		BurstRate:     l.BurstRate,
+		BurstInterval: l.BurstInterval,
+		BurstDuration: l.BurstDuration,
+		PayloadSize: pulsarotel.PayloadSize{
+			Distribution: l.PayloadDistribution,
+			Min:          l.PayloadMin,
+			Max:          l.PayloadMax,
+		},
+		Keys:     l.Keys,
+		Duration: l.Duration,
+		Count:    int64(l.Count),
+		Workers:  l.Workers,
+	}
+}
+
+// ConsumerConfig holds the settings of the demo consumer
+type ConsumerConfig struct {
+	Subscription     string        `yaml:"subscription"`
+	SubscriptionType string        `yaml:"subscription_type"`
+	ProcessingDelay  time.Duration `yaml:"processing_delay"`
+	Workers          int           `yaml:"workers"`
+	MaxInFlight      int           `yaml:"max_in_flight"`
+	KeyOrdering      bool          `yaml:"key_ordering"`
+	Propagation      string        `yaml:"propagation"`
+	BaggageKeys      []string      `yaml:"baggage_keys"`
+	Retry            RetryConfig   `yaml:"retry"`
+}
+
+// RetryConfig holds the retry and dead letter settings of the consumer
+type RetryConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	MaxRetries      int           `yaml:"max_retries"`
+	InitialBackoff  time.Duration `yaml:"initial_backoff"`
+	MaxBackoff      time.Duration `yaml:"max_backoff"`
+	RetryTopic      string        `yaml:"retry_topic"`
+	DeadLetterTopic string        `yaml:"dead_letter_topic"`
+}
+
+// TelemetryConfig holds the OpenTelemetry exporter settings
+type TelemetryConfig struct {
+	OTLPProtocol           string            `yaml:"otlp_protocol"`
+	OTLPEndpoint           string            `yaml:"otlp_endpoint"`
+	TracesProtocol         string            `yaml:"traces_protocol"`
+	TracesEndpoint         string            `yaml:"traces_endpoint"`
+	MetricsProtocol        string            `yaml:"metrics_protocol"`
+	MetricsEndpoint        string            `yaml:"metrics_endpoint"`
+	LogsProtocol           string            `yaml:"logs_protocol"`
+	LogsEndpoint           string            `yaml:"logs_endpoint"`
+	Insecure               bool              `yaml:"insecure"`
+	Headers                map[string]string `yaml:"headers"`
+	Propagators            string            `yaml:"propagators"`
+	Sampler                string            `yaml:"sampler"`
+	SamplerArg             float64           `yaml:"sampler_arg"`
+	RespectMessageSampling bool              `yaml:"respect_message_sampling"`
+	TraceBatchTimeout      time.Duration     `yaml:"trace_batch_timeout"`
+	TraceMaxBatchSize      int               `yaml:"trace_max_batch_size"`
+	MetricExportInterval   time.Duration     `yaml:"metric_export_interval"`
+	MetricExportTimeout    time.Duration     `yaml:"metric_export_timeout"`
+	SystemMetricsInterval  time.Duration     `yaml:"system_metrics_interval"`
+	Prometheus             bool              `yaml:"prometheus"`
+	MetricNames            string            `yaml:"metric_names"`
+	TopicStats             bool              `yaml:"topic_stats"`
+	TopicStatsInterval     time.Duration     `yaml:"topic_stats_interval"`
+}
+
+// AdminConfig holds the settings of the admin HTTP server
+type AdminConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Addr           string        `yaml:"addr"`
+	StallThreshold time.Duration `yaml:"stall_threshold"`
+	ExportFailures int           `yaml:"export_failures"`
+}
+
+// Run modes accepted in ServiceConfig.Mode
+var modes = []string{"producer", "consumer", "both"}
+
+// Subscription types accepted in ConsumerConfig.SubscriptionType
+var subscriptionTypes = []string{"exclusive", "shared", "failover", "key_shared"}
+
+// Samplers accepted in TelemetryConfig.Sampler, as defined for OTEL_TRACES_SAMPLER
+var samplers = []string{
+	"always_on", "always_off", "traceidratio",
+	"parentbased_always_on", "parentbased_always_off", "parentbased_traceidratio",
+}
+
+// Propagators accepted in TelemetryConfig.Propagators, as defined for OTEL_PROPAGATORS
+var propagators = []string{"tracecontext", "baggage", "b3", "b3multi", "jaeger", "xray", "none"}
+
+// Relations of the process span to the producer span accepted in
+// ConsumerConfig.Propagation
+var propagationModes = []string{"parent", "link"}
+
+// Names of the publish and consume metrics accepted in TelemetryConfig.MetricNames
+var metricNames = []string{"semconv", "legacy", "both"}
+
+// Payload codecs accepted in PulsarConfig.Codec
+var codecs = []string{"json", "avro", "protobuf"}
+
+// Contract validation modes accepted in PulsarConfig.Contract
+var contractModes = []string{"off", "warn", "strict"}
+
+// OTLP protocols accepted in TelemetryConfig
+var otlpProtocols = []string{"grpc", "http/protobuf", "http/json"}
+
+// Default returns the configuration used when no file or environment
+// variable overrides a setting
+func Default() *Config {
+	return &Config{
+		Service: ServiceConfig{
+			Name:            "pulsar-otel-example",
+			Version:         "0.1.0",
+			Environment:     "development",
+			Mode:            "both",
+			ShutdownTimeout: 20 * time.Second,
+		},
+		Pulsar: PulsarConfig{
+			URL:               "pulsar://localhost:6650",
+			Topic:             "my-topic",
+			OperationTimeout:  30 * time.Second,
+			ConnectionTimeout: 30 * time.Second,
+			AdminURL:          "http://localhost:8080",
+			Codec:             "json",
+			Contract:          "off",
+			TLS: TLSConfig{
+				ValidateHostname: true,
+				ReloadInterval:   time.Minute,
+			},
+		},
+		Producer: ProducerConfig{
+			Name:     "my-producer",
+			Interval: 2 * time.Second,
+			Baggage: map[string]string{
+				"tenant.id":      "workshop",
+				"request.origin": "demo-producer",
+			},
+			Load: LoadConfig{
+				PayloadDistribution: "fixed",
+				PayloadMin:          64,
+				PayloadMax:          256,
+				Workers:             4,
+			},
+		},
+		Consumer: ConsumerConfig{
+			Subscription:     "my-subscription",
+			SubscriptionType: "shared",
+			ProcessingDelay:  500 * time.Millisecond,
+			Workers:          1,
+			Propagation:      "parent",
+			BaggageKeys:      []string{"tenant.id", "request.origin"},
+			Retry: RetryConfig{
+				MaxRetries:     3,
+				InitialBackoff: time.Second,
+				MaxBackoff:     time.Minute,
+			},
+		},
+		Telemetry: TelemetryConfig{
+			OTLPProtocol:          "grpc",
+			Propagators:           "tracecontext,baggage",
+			Sampler:               "parentbased_always_on",
+			SamplerArg:            1.0,
+			TraceBatchTimeout:     5 * time.Second,
+			TraceMaxBatchSize:     10,
+			MetricExportInterval:  15 * time.Second,
+			MetricExportTimeout:   10 * time.Second,
+			SystemMetricsInterval: 15 * time.Second,
+			MetricNames:           "legacy",
+			TopicStatsInterval:    30 * time.Second,
+		},
+		Admin: AdminConfig{
+			Enabled:        true,
+			Addr:           ":9464",
+			StallThreshold: time.Minute,
+			ExportFailures: 3,
+		},
+	}
+}
+
+// Load reads the configuration file at path on top of the defaults, applies
+// the environment variable overrides and validates the result. An empty path
+// skips the file.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// envOverride binds an environment variable to a configuration field
+type envOverride struct {
+	key   string
+	apply func(value string) error
+}
+
+// applyEnv overrides configuration values with the environment variables
+// that are set
+func (c *Config) applyEnv() error {
+	overrides := []envOverride{
+		{"SERVICE_NAME", setString(&c.Service.Name)},
+		{"SERVICE_VERSION", setString(&c.Service.Version)},
+		{"SERVICE_MODE", setString(&c.Service.Mode)},
+		{"SERVICE_ENVIRONMENT", setString(&c.Service.Environment)},
+		{"SHUTDOWN_TIMEOUT", setDuration(&c.Service.ShutdownTimeout)},
+		{"PULSAR_URL", setString(&c.Pulsar.URL)},
+		{"PULSAR_AUTH_TOKEN", setString(&c.Pulsar.AuthToken)},
+		{"PULSAR_AUTH_TOKEN_FILE", setString(&c.Pulsar.AuthTokenFile)},
+		{"PULSAR_OAUTH2_ISSUER_URL", setString(&c.Pulsar.OAuth2.IssuerURL)},
+		{"PULSAR_OAUTH2_AUDIENCE", setString(&c.Pulsar.OAuth2.Audience)},
+		{"PULSAR_OAUTH2_PRIVATE_KEY_FILE", setString(&c.Pulsar.OAuth2.PrivateKeyFile)},
+		{"PULSAR_OAUTH2_SCOPE", setString(&c.Pulsar.OAuth2.Scope)},
+		{"PULSAR_TOPIC", setString(&c.Pulsar.Topic)},
+		{"PULSAR_OPERATION_TIMEOUT", setDuration(&c.Pulsar.OperationTimeout)},
+		{"PULSAR_CONNECTION_TIMEOUT", setDuration(&c.Pulsar.ConnectionTimeout)},
+		{"PULSAR_ADMIN_URL", setString(&c.Pulsar.AdminURL)},
+		{"PULSAR_CODEC", setString(&c.Pulsar.Codec)},
+		{"PULSAR_CONTRACT", setString(&c.Pulsar.Contract)},
+		{"PULSAR_TLS_TRUST_CERTS_FILE", setString(&c.Pulsar.TLS.TrustCertsFile)},
+		{"PULSAR_TLS_VALIDATE_HOSTNAME", setBool(&c.Pulsar.TLS.ValidateHostname)},
+		{"PULSAR_TLS_ALLOW_INSECURE", setBool(&c.Pulsar.TLS.AllowInsecure)},
+		{"PULSAR_TLS_CERT_FILE", setString(&c.Pulsar.TLS.CertFile)},
+		{"PULSAR_TLS_KEY_FILE", setString(&c.Pulsar.TLS.KeyFile)},
+		{"PULSAR_TLS_RELOAD_INTERVAL", setDuration(&c.Pulsar.TLS.ReloadInterval)},
+		{"PULSAR_PRODUCER_NAME", setString(&c.Producer.Name)},
+		{"PULSAR_PRODUCER_INTERVAL", setDuration(&c.Producer.Interval)},
+		{"PULSAR_PRODUCER_BAGGAGE", setKeyValues(&c.Producer.Baggage)},
+		{"PULSAR_LOAD_RATE", setFloat(&c.Producer.Load.Rate)},
+		{"PULSAR_LOAD_RAMP_UP", setDuration(&c.Producer.Load.RampUp)},
+		{"PULSAR_LOAD_RAMP_DOWN", setDuration(&c.Producer.Load.RampDown)},
+		{"PULSAR_LOAD_BURST_RATE", setFloat(&c.Producer.Load.BurstRate)},
+		{"PULSAR_LOAD_BURST_INTERVAL", setDuration(&c.Producer.Load.BurstInterval)},
+		{"PULSAR_LOAD_BURST_DURATION", setDuration(&c.Producer.Load.BurstDuration)},
+		{"PULSAR_LOAD_PAYLOAD_DISTRIBUTION", setString(&c.Producer.Load.PayloadDistribution)},
+		{"PULSAR_LOAD_PAYLOAD_MIN", setInt(&c.Producer.Load.PayloadMin)},
+		{"PULSAR_LOAD_PAYLOAD_MAX", setInt(&c.Producer.Load.PayloadMax)},
+		{"PULSAR_LOAD_KEYS", setInt(&c.Producer.Load.Keys)},
+		{"PULSAR_LOAD_DURATION", setDuration(&c.Producer.Load.Duration)},
+		{"PULSAR_LOAD_COUNT", setInt(&c.Producer.Load.Count)},
+		{"PULSAR_LOAD_WORKERS", setInt(&c.Producer.Load.Workers)},
+		{"PULSAR_SUBSCRIPTION", setString(&c.Consumer.Subscription)},
+		{"PULSAR_SUBSCRIPTION_TYPE", setString(&c.Consumer.SubscriptionType)},
+		{"PULSAR_CONSUMER_PROCESSING_DELAY", setDuration(&c.Consumer.ProcessingDelay)},
+		{"PULSAR_CONSUMER_WORKERS", setInt(&c.Consumer.Workers)},
+		{"PULSAR_CONSUMER_MAX_IN_FLIGHT", setInt(&c.Consumer.MaxInFlight)},
+		{"PULSAR_CONSUMER_KEY_ORDERING", setBool(&c.Consumer.KeyOrdering)},
+		{"PULSAR_CONSUMER_PROPAGATION", setString(&c.Consumer.Propagation)},
+		{"PULSAR_CONSUMER_BAGGAGE_KEYS", setList(&c.Consumer.BaggageKeys)},
+		{"PULSAR_RETRY_ENABLED", setBool(&c.Consumer.Retry.Enabled)},
+		{"PULSAR_RETRY_MAX_RETRIES", setInt(&c.Consumer.Retry.MaxRetries)},
+		{"PULSAR_RETRY_INITIAL_BACKOFF", setDuration(&c.Consumer.Retry.InitialBackoff)},
+		{"PULSAR_RETRY_MAX_BACKOFF", setDuration(&c.Consumer.Retry.MaxBackoff)},
+		{"PULSAR_RETRY_TOPIC", setString(&c.Consumer.Retry.RetryTopic)},
+		{"PULSAR_DEAD_LETTER_TOPIC", setString(&c.Consumer.Retry.DeadLetterTopic)},
+		{"OTEL_EXPORTER_OTLP_PROTOCOL", setString(&c.Telemetry.OTLPProtocol)},
+		{"OTEL_EXPORTER_OTLP_ENDPOINT", setString(&c.Telemetry.OTLPEndpoint)},
+		{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", setString(&c.Telemetry.TracesProtocol)},
+		{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", setString(&c.Telemetry.TracesEndpoint)},
+		{"OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", setString(&c.Telemetry.MetricsProtocol)},
+		{"OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", setString(&c.Telemetry.MetricsEndpoint)},
+		{"OTEL_EXPORTER_OTLP_LOGS_PROTOCOL", setString(&c.Telemetry.LogsProtocol)},
+		{"OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", setString(&c.Telemetry.LogsEndpoint)},
+		{"OTEL_EXPORTER_OTLP_INSECURE", setBool(&c.Telemetry.Insecure)},
+		{"OTEL_EXPORTER_OTLP_HEADERS", setKeyValues(&c.Telemetry.Headers)},
+		{"OTEL_PROPAGATORS", setString(&c.Telemetry.Propagators)},
+		{"OTEL_TRACES_SAMPLER", setString(&c.Telemetry.Sampler)},
+		{"OTEL_TRACES_SAMPLER_ARG", setFloat(&c.Telemetry.SamplerArg)},
+		{"PULSAR_RESPECT_MESSAGE_SAMPLING", setBool(&c.Telemetry.RespectMessageSampling)},
+		{"OTEL_BSP_SCHEDULE_DELAY", setMilliseconds(&c.Telemetry.TraceBatchTimeout)},
+		{"OTEL_BSP_MAX_EXPORT_BATCH_SIZE", setInt(&c.Telemetry.TraceMaxBatchSize)},
+		{"OTEL_METRIC_EXPORT_INTERVAL", setMilliseconds(&c.Telemetry.MetricExportInterval)},
+		{"OTEL_METRIC_EXPORT_TIMEOUT", setMilliseconds(&c.Telemetry.MetricExportTimeout)},
+		{"SYSTEM_METRICS_INTERVAL", setDuration(&c.Telemetry.SystemMetricsInterval)},
+		{"PROMETHEUS_ENABLED", setBool(&c.Telemetry.Prometheus)},
+		{"PULSAR_METRIC_NAMES", setString(&c.Telemetry.MetricNames)},
+		{"PULSAR_TOPIC_STATS_ENABLED", setBool(&c.Telemetry.TopicStats)},
+		{"PULSAR_TOPIC_STATS_INTERVAL", setDuration(&c.Telemetry.TopicStatsInterval)},
+		{"ADMIN_ENABLED", setBool(&c.Admin.Enabled)},
+		{"ADMIN_ADDR", setString(&c.Admin.Addr)},
+		{"ADMIN_STALL_THRESHOLD", setDuration(&c.Admin.StallThreshold)},
+		{"ADMIN_EXPORT_FAILURES", setInt(&c.Admin.ExportFailures)},
+	}
+
+	var errs []error
+	for _, o := range overrides {
+		value, ok := os.LookupEnv(o.key)
+		if !ok || value == "" {
+			continue
+		}
+		if err := o.apply(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", o.key, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment variable: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Validate checks that the configuration is usable and reports every
+// problem found
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Service.Name != "", "service.name must not be empty")
+	check(c.Service.ShutdownTimeout > 0, "service.shutdown_timeout must be positive")
+	check(slices.Contains(modes, c.Service.Mode),
+		"service.mode %q must be one of %s", c.Service.Mode, strings.Join(modes, ", "))
+
+	check(c.Pulsar.URL != "", "pulsar.url must not be empty")
+	if c.Pulsar.URL != "" {
+		u, err := url.Parse(c.Pulsar.URL)
+		check(err == nil && (u.Scheme == "pulsar" || u.Scheme == "pulsar+ssl"),
+			"pulsar.url %q must use the pulsar:// or pulsar+ssl:// scheme", c.Pulsar.URL)
+	}
+	check(c.Pulsar.Topic != "", "pulsar.topic must not be empty")
+	check(c.Pulsar.OperationTimeout > 0, "pulsar.operation_timeout must be positive")
+	check(c.Pulsar.ConnectionTimeout > 0, "pulsar.connection_timeout must be positive")
+	check(slices.Contains(codecs, c.Pulsar.Codec),
+		"pulsar.codec %q must be one of %s", c.Pulsar.Codec, strings.Join(codecs, ", "))
+	check(slices.Contains(contractModes, c.Pulsar.Contract),
+		"pulsar.contract %q must be one of %s", c.Pulsar.Contract, strings.Join(contractModes, ", "))
+	check((c.Pulsar.TLS.CertFile == "") == (c.Pulsar.TLS.KeyFile == ""),
+		"pulsar.tls.cert_file and pulsar.tls.key_file must be set together")
+	if !strings.HasPrefix(c.Pulsar.URL, "pulsar+ssl://") {
+		// Certificates would otherwise travel over a plaintext connection
+		for _, file := range []struct {
+			field string
+			set   bool
+		}{
+			{"pulsar.tls.trust_certs_file", c.Pulsar.TLS.TrustCertsFile != ""},
+			{"pulsar.tls.cert_file", c.Pulsar.TLS.CertFile != ""},
+			{"pulsar.tls.key_file", c.Pulsar.TLS.KeyFile != ""},
+		} {
+			check(!file.set, "%s requires a pulsar+ssl:// pulsar.url", file.field)
+		}
+	}
+	var authMethods []string
+	for _, method := range []struct {
+		field string
+		set   bool
+	}{
+		{"pulsar.auth_token", c.Pulsar.AuthToken != ""},
+		{"pulsar.auth_token_file", c.Pulsar.AuthTokenFile != ""},
+		{"pulsar.oauth2.private_key_file", c.Pulsar.OAuth2.PrivateKeyFile != ""},
+		{"pulsar.tls.cert_file", c.Pulsar.TLS.CertFile != ""},
+	} {
+		if method.set {
+			authMethods = append(authMethods, method.field)
+		}
+	}
+	check(len(authMethods) <= 1,
+		"%s are exclusive authentication methods, set only one", strings.Join(authMethods, " and "))
+	if c.Pulsar.OAuth2.PrivateKeyFile != "" {
+		u, err := url.Parse(c.Pulsar.OAuth2.IssuerURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"pulsar.oauth2.issuer_url %q must be an http:// or https:// URL", c.Pulsar.OAuth2.IssuerURL)
+		check(c.Pulsar.OAuth2.Audience != "", "pulsar.oauth2.audience must not be empty")
+	}
+	check(c.Pulsar.TLS.ReloadInterval > 0, "pulsar.tls.reload_interval must be positive")
+
+	check(c.Producer.Interval > 0, "producer.interval must be positive")
+	if c.Producer.Load.Rate != 0 {
+		err := c.Producer.Load.Profile().Validate()
+		check(err == nil, "producer.load: %v", err)
+	}
+
+	// A producer alone subscribes to nothing
+	check(c.Service.Mode == "producer" || c.Consumer.Subscription != "", "consumer.subscription must not be empty")
+	check(slices.Contains(subscriptionTypes, c.Consumer.SubscriptionType),
+		"consumer.subscription_type %q must be one of %s", c.Consumer.SubscriptionType, strings.Join(subscriptionTypes, ", "))
+	check(c.Consumer.ProcessingDelay >= 0, "consumer.processing_delay must not be negative")
+	check(c.Consumer.Workers > 0, "consumer.workers must be positive")
+	// Zero keeps as many messages in flight as workers
+	check(c.Consumer.MaxInFlight == 0 || c.Consumer.MaxInFlight >= c.Consumer.Workers,
+		"consumer.max_in_flight must not be lower than consumer.workers")
+	check(slices.Contains(propagationModes, c.Consumer.Propagation),
+		"consumer.propagation %q must be one of %s", c.Consumer.Propagation, strings.Join(propagationModes, ", "))
+	if c.Consumer.Retry.Enabled {
+		// Pulsar rejects a DLQ policy without deliveries
+		check(c.Consumer.Retry.MaxRetries >= 1, "consumer.retry.max_retries must be at least 1")
+		check(c.Consumer.Retry.InitialBackoff > 0, "consumer.retry.initial_backoff must be positive")
+		check(c.Consumer.Retry.MaxBackoff >= c.Consumer.Retry.InitialBackoff,
+			"consumer.retry.max_backoff must not be lower than consumer.retry.initial_backoff")
+	}
+
+	checkProtocol := func(field, protocol string, optional bool) {
+		if protocol == "" && optional {
+			return
+		}
+		check(slices.Contains(otlpProtocols, protocol),
+			"%s %q must be one of %s", field, protocol, strings.Join(otlpProtocols, ", "))
+	}
+	checkProtocol("telemetry.otlp_protocol", c.Telemetry.OTLPProtocol, false)
+	checkProtocol("telemetry.traces_protocol", c.Telemetry.TracesProtocol, true)
+	checkProtocol("telemetry.metrics_protocol", c.Telemetry.MetricsProtocol, true)
+	checkProtocol("telemetry.logs_protocol", c.Telemetry.LogsProtocol, true)
+	check(slices.Contains(metricNames, c.Telemetry.MetricNames),
+		"telemetry.metric_names %q must be one of %s", c.Telemetry.MetricNames, strings.Join(metricNames, ", "))
+	for _, name := range strings.Split(c.Telemetry.Propagators, ",") {
+		name = strings.TrimSpace(name)
+		check(slices.Contains(propagators, name),
+			"telemetry.propagators %q must be a comma-separated list of %s", name, strings.Join(propagators, ", "))
+	}
+	check(slices.Contains(samplers, c.Telemetry.Sampler),
+		"telemetry.sampler %q must be one of %s", c.Telemetry.Sampler, strings.Join(samplers, ", "))
+	check(c.Telemetry.SamplerArg >= 0 && c.Telemetry.SamplerArg <= 1,
+		"telemetry.sampler_arg %v must be a ratio between 0 and 1", c.Telemetry.SamplerArg)
+	check(c.Telemetry.TraceBatchTimeout > 0, "telemetry.trace_batch_timeout must be positive")
+	check(c.Telemetry.TraceMaxBatchSize > 0, "telemetry.trace_max_batch_size must be positive")
+	check(c.Telemetry.MetricExportInterval > 0, "telemetry.metric_export_interval must be positive")
+	check(c.Telemetry.MetricExportTimeout > 0, "telemetry.metric_export_timeout must be positive")
+	check(c.Telemetry.SystemMetricsInterval > 0, "telemetry.system_metrics_interval must be positive")
+
+	if c.Telemetry.TopicStats {
+		u, err := url.Parse(c.Pulsar.AdminURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"pulsar.admin_url %q must be an http:// or https:// URL", c.Pulsar.AdminURL)
+		check(c.Telemetry.TopicStatsInterval > 0, "telemetry.topic_stats_interval must be positive")
+	}
+	check(!c.Telemetry.Prometheus || c.Admin.Enabled,
+		"telemetry.prometheus requires admin.enabled to serve /metrics")
+	if c.Admin.Enabled {
+		check(c.Admin.Addr != "", "admin.addr must not be empty")
+		check(c.Admin.StallThreshold > 0, "admin.stall_threshold must be positive")
+		check(c.Admin.ExportFailures > 0, "admin.export_failures must be positive")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func setString(dst *string) func(string) error {
+	return func(value string) error {
+		*dst = value
+		return nil
+	}
+}
+
+func setBool(dst *bool) func(string) error {
+	return func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		*dst = b
+		return nil
+	}
+}
+
+func setInt(dst *int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*dst = n
+		return nil
+	}
+}
+
+func setFloat(dst *float64) func(string) error {
+	return func(value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*dst = f
+		return nil
+	}
+}
+
+func setDuration(dst *time.Duration) func(string) error {
+	return func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 500ms or 2s", value)
+		}
+		*dst = d
+		return nil
+	}
+}
+
+// setMilliseconds parses an integer number of milliseconds, the format the
+// OpenTelemetry specification uses for OTEL_BSP_* and OTEL_METRIC_* variables
+func setMilliseconds(dst *time.Duration) func(string) error {
+	return func(value string) error {
+		ms, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number of milliseconds", value)
+		}
+		*dst = time.Duration(ms) * time.Millisecond
+		return nil
+	}
+}
+
+// setKeyValues parses pairs in format "key1=value1,key2=value2"
+func setKeyValues(dst *map[string]string) func(string) error {
+	return func(value string) error {
+		pairs := make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("%q is not in key=value format", pair)
+			}
+			pairs[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+		*dst = pairs
+		return nil
+	}
+}
+
+// setList parses a comma-separated list, dropping empty items
+func setList(dst *[]string) func(string) error {
+	return func(value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*dst = items
+		return nil
+	}
+}
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadAppliesFileAndEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	err := os.WriteFile(path, []byte(`
+pulsar:
+  topic: file-topic
+consumer:
+  workers: 2
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PULSAR_TOPIC", "env-topic")
+	t.Setenv("PULSAR_CONSUMER_MAX_IN_FLIGHT", "8")
+	t.Setenv("PULSAR_OPERATION_TIMEOUT", "5s")
+	t.Setenv("OTEL_BSP_SCHEDULE_DELAY", "250")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0.25")
+	t.Setenv("PULSAR_RETRY_ENABLED", "true")
+	t.Setenv("PULSAR_PRODUCER_BAGGAGE", "tenant.id=acme, request.origin=test")
+	t.Setenv("PULSAR_CONSUMER_BAGGAGE_KEYS", "tenant.id,,order.id")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Pulsar.Topic != "env-topic" {
+		t.Errorf("pulsar.topic = %q, want the environment override", cfg.Pulsar.Topic)
+	}
+	if cfg.Consumer.Workers != 2 {
+		t.Errorf("consumer.workers = %d, want 2 from the file", cfg.Consumer.Workers)
+	}
+	if cfg.Consumer.MaxInFlight != 8 {
+		t.Errorf("consumer.max_in_flight = %d, want 8", cfg.Consumer.MaxInFlight)
+	}
+	if cfg.Pulsar.OperationTimeout != 5*time.Second {
+		t.Errorf("pulsar.operation_timeout = %s, want 5s", cfg.Pulsar.OperationTimeout)
+	}
+	if cfg.Telemetry.TraceBatchTimeout != 250*time.Millisecond {
+		t.Errorf("telemetry.trace_batch_timeout = %s, want 250ms", cfg.Telemetry.TraceBatchTimeout)
+	}
+	if cfg.Telemetry.SamplerArg != 0.25 {
+		t.Errorf("telemetry.sampler_arg = %v, want 0.25", cfg.Telemetry.SamplerArg)
+	}
+	if !cfg.Consumer.Retry.Enabled {
+		t.Error("consumer.retry.enabled = false, want true")
+	}
+	if got := cfg.Producer.Baggage; len(got) != 2 || got["tenant.id"] != "acme" || got["request.origin"] != "test" {
+		t.Errorf("producer.baggage = %v, want tenant.id=acme and request.origin=test", got)
+	}
+	if got := cfg.Consumer.BaggageKeys; len(got) != 2 || got[0] != "tenant.id" || got[1] != "order.id" {
+		t.Errorf("consumer.baggage_keys = %v, want [tenant.id order.id]", got)
+	}
+	if cfg.Service.Name != Default().Service.Name {
+		t.Errorf("service.name = %q, want the default", cfg.Service.Name)
+	}
+}
+
+func TestLoadRejectsInvalidEnv(t *testing.T) {
+	tests := []struct {
+		key, value string
+	}{
+		{"PULSAR_OPERATION_TIMEOUT", "30"},
+		{"PULSAR_CONSUMER_WORKERS", "two"},
+		{"OTEL_TRACES_SAMPLER_ARG", "half"},
+		{"ADMIN_ENABLED", "yes please"},
+		{"OTEL_METRIC_EXPORT_INTERVAL", "15s"},
+		{"OTEL_EXPORTER_OTLP_HEADERS", "authorization"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			_, err := Load("")
+			if err == nil || !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("Load with %s=%q error = %v, want an error naming %s", tt.key, tt.value, err, tt.key)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		// want is part of the expected error, empty when the configuration
+		// is valid
+		want string
+	}{
+		{
+			name:   "unknown mode",
+			modify: func(c *Config) { c.Service.Mode = "relay" },
+			want:   "service.mode",
+		},
+		{
+			name:   "non Pulsar URL",
+			modify: func(c *Config) { c.Pulsar.URL = "http://localhost:6650" },
+			want:   "pulsar.url",
+		},
+		{
+			name:   "trust certs on plaintext URL",
+			modify: func(c *Config) { c.Pulsar.TLS.TrustCertsFile = "ca.pem" },
+			want:   "pulsar.tls.trust_certs_file requires a pulsar+ssl:// pulsar.url",
+		},
+		{
+			name: "client certificate on plaintext URL",
+			modify: func(c *Config) {
+				c.Pulsar.TLS.CertFile = "client.pem"
+				c.Pulsar.TLS.KeyFile = "client-key.pem"
+			},
+			want: "pulsar.tls.cert_file requires a pulsar+ssl:// pulsar.url",
+		},
+		{
+			name: "client certificate on TLS URL",
+			modify: func(c *Config) {
+				c.Pulsar.URL = "pulsar+ssl://localhost:6651"
+				c.Pulsar.TLS.TrustCertsFile = "ca.pem"
+				c.Pulsar.TLS.CertFile = "client.pem"
+				c.Pulsar.TLS.KeyFile = "client-key.pem"
+			},
+		},
+		{
+			name: "certificate without key",
+			modify: func(c *Config) {
+				c.Pulsar.URL = "pulsar+ssl://localhost:6651"
+				c.Pulsar.TLS.CertFile = "client.pem"
+			},
+			want: "must be set together",
+		},
+		{
+			name: "token and token file",
+			modify: func(c *Config) {
+				c.Pulsar.AuthToken = "token"
+				c.Pulsar.AuthTokenFile = "token.jwt"
+			},
+			want: "pulsar.auth_token and pulsar.auth_token_file are exclusive",
+		},
+		{
+			name: "OAuth2 and client certificate",
+			modify: func(c *Config) {
+				c.Pulsar.URL = "pulsar+ssl://localhost:6651"
+				c.Pulsar.TLS.CertFile = "client.pem"
+				c.Pulsar.TLS.KeyFile = "client-key.pem"
+				c.Pulsar.OAuth2 = OAuth2Config{
+					IssuerURL:      "https://auth.example.com",
+					Audience:       "urn:pulsar",
+					PrivateKeyFile: "key.json",
+				}
+			},
+			want: "pulsar.oauth2.private_key_file and pulsar.tls.cert_file are exclusive",
+		},
+		{
+			name: "OAuth2 without issuer",
+			modify: func(c *Config) {
+				c.Pulsar.OAuth2 = OAuth2Config{Audience: "urn:pulsar", PrivateKeyFile: "key.json"}
+			},
+			want: "pulsar.oauth2.issuer_url",
+		},
+		{
+			name:   "consumer without subscription",
+			modify: func(c *Config) { c.Consumer.Subscription = "" },
+			want:   "consumer.subscription must not be empty",
+		},
+		{
+			name: "producer without subscription",
+			modify: func(c *Config) {
+				c.Service.Mode = "producer"
+				c.Consumer.Subscription = ""
+			},
+		},
+		{
+			name:   "unknown codec",
+			modify: func(c *Config) { c.Pulsar.Codec = "thrift" },
+			want:   "pulsar.codec",
+		},
+		{
+			name:   "protobuf codec",
+			modify: func(c *Config) { c.Pulsar.Codec = "protobuf" },
+		},
+		{
+			name: "retries disabled without retries",
+			modify: func(c *Config) {
+				c.Consumer.Retry.MaxRetries = 0
+			},
+		},
+		{
+			name: "retries enabled without retries",
+			modify: func(c *Config) {
+				c.Consumer.Retry.Enabled = true
+				c.Consumer.Retry.MaxRetries = 0
+			},
+			want: "consumer.retry.max_retries must be at least 1",
+		},
+		{
+			name: "max backoff below initial backoff",
+			modify: func(c *Config) {
+				c.Consumer.Retry.Enabled = true
+				c.Consumer.Retry.MaxBackoff = time.Millisecond
+			},
+			want: "consumer.retry.max_backoff",
+		},
+		{
+			name: "max in flight below workers",
+			modify: func(c *Config) {
+				c.Consumer.Workers = 4
+				c.Consumer.MaxInFlight = 2
+			},
+			want: "consumer.max_in_flight must not be lower than consumer.workers",
+		},
+		{
+			name: "max in flight defaulting to workers",
+			modify: func(c *Config) {
+				c.Consumer.Workers = 4
+				c.Consumer.MaxInFlight = 0
+			},
+		},
+		{
+			name:   "no workers",
+			modify: func(c *Config) { c.Consumer.Workers = 0 },
+			want:   "consumer.workers",
+		},
+		{
+			name:   "http/json protocol",
+			modify: func(c *Config) { c.Telemetry.OTLPProtocol = "http/json" },
+		},
+		{
+			name:   "http/json logs protocol",
+			modify: func(c *Config) { c.Telemetry.LogsProtocol = "http/json" },
+		},
+		{
+			name:   "no export failures",
+			modify: func(c *Config) { c.Admin.ExportFailures = 0 },
+			want:   "admin.export_failures",
+		},
+		{
+			name:   "unknown protocol",
+			modify: func(c *Config) { c.Telemetry.MetricsProtocol = "http/xml" },
+			want:   `telemetry.metrics_protocol "http/xml" must be one of`,
+		},
+		{
+			name:   "http/protobuf traces protocol",
+			modify: func(c *Config) { c.Telemetry.TracesProtocol = "http/protobuf" },
+		},
+		{
+			name:   "unknown propagator",
+			modify: func(c *Config) { c.Telemetry.Propagators = "tracecontext,zipkin" },
+			want:   "telemetry.propagators",
+		},
+		{
+			name:   "sampler ratio above one",
+			modify: func(c *Config) { c.Telemetry.SamplerArg = 1.5 },
+			want:   "telemetry.sampler_arg",
+		},
+		{
+			name: "prometheus without admin server",
+			modify: func(c *Config) {
+				c.Telemetry.Prometheus = true
+				c.Admin.Enabled = false
+			},
+			want: "telemetry.prometheus requires admin.enabled",
+		},
+		{
+			name: "topic stats without admin URL",
+			modify: func(c *Config) {
+				c.Telemetry.TopicStats = true
+				c.Pulsar.AdminURL = "localhost:8080"
+			},
+			want: "pulsar.admin_url",
+		},
+		{
+			name:   "invalid load profile",
+			modify: func(c *Config) { c.Producer.Load.Rate = -1 },
+			want:   "producer.load",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("Validate() = %v, want no error", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := Default()
+	cfg.Service.Name = ""
+	cfg.Pulsar.Topic = ""
+	cfg.Consumer.Subscription = ""
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() succeeded, want an error")
+	}
+	for _, field := range []string{"service.name", "pulsar.topic", "consumer.subscription"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Validate() = %v, want %s reported", err, field)
+		}
+	}
+}
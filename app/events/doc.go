@@ -0,0 +1,5 @@
+// Package events holds the message payloads declared in async-spec.yml,
+// generated by cmd/asyncapi-gen.
+package events
+
+//go:generate go run ../cmd/asyncapi-gen -spec ../async-spec.yml -out events_gen.go -package events
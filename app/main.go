@@ -2,57 +2,36 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/apache/pulsar-client-go/pulsar"
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/mem"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
-	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
-	"go.opentelemetry.io/otel/metric"
-	"go.opentelemetry.io/otel/propagation"
-	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
-	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
-)
 
-const (
-	serviceName    = "pulsar-otel-example"
-	serviceVersion = "0.1.0"
+	"github.com/eduardofesilva/async-eda-otel-workshop/app/admin"
+	"github.com/eduardofesilva/async-eda-otel-workshop/app/config"
+	"github.com/eduardofesilva/async-eda-otel-workshop/app/events"
+	"github.com/eduardofesilva/async-eda-otel-workshop/app/pulsarotel"
 )
 
-var (
-	logger *zap.Logger
-	tracer trace.Tracer
-
-	// Metric instruments
-	messagesPublished       metric.Int64Counter
-	messagesConsumed        metric.Int64Counter
-	messagePublishLatency   metric.Float64Histogram
-	messageConsumeLatency   metric.Float64Histogram
-	activePulsarConnections metric.Int64UpDownCounter
-
-	// System metrics for Elastic APM
-	systemCPUUsage    metric.Float64Gauge
-	systemMemoryUsage metric.Float64Gauge
-	systemMemoryTotal metric.Float64Gauge
-)
+var logger *zap.Logger
 
 func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to the YAML configuration file")
+	mode := flag.String("mode", "", "run the producer, the consumer or both, overrides service.mode")
+	flag.Parse()
+
 	// Initialize logger
 	var err error
 	logger, err = initLogger()
@@ -61,55 +40,202 @@ func main() {
 	}
 	defer logger.Sync()
 
-	// Initialize tracer
-	tp, err := initTracer()
+	// Load and validate configuration
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		logger.Fatal("Failed to initialize tracer", zap.Error(err))
+		logger.Fatal("Failed to load configuration", zap.Error(err))
 	}
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := tp.Shutdown(ctx); err != nil {
-			logger.Error("Error shutting down tracer provider", zap.Error(err))
+	if *mode != "" {
+		cfg.Service.Mode = *mode
+		if err := cfg.Validate(); err != nil {
+			logger.Fatal("Failed to load configuration", zap.Error(err))
 		}
-	}()
+	}
+	produces := cfg.Service.Mode != "consumer"
+	consumes := cfg.Service.Mode != "producer"
+
+	sampler, err := pulsarotel.NewSampler(cfg.Telemetry.Sampler, cfg.Telemetry.SamplerArg)
+	if err != nil {
+		logger.Fatal("Failed to create sampler", zap.Error(err))
+	}
+	propagator, err := pulsarotel.NewPropagator(cfg.Telemetry.Propagators)
+	if err != nil {
+		logger.Fatal("Failed to create propagator", zap.Error(err))
+	}
 
-	// Initialize metrics
-	mp, err := initMeter()
+	// Initialize tracing, metrics and logs
+	tel, err := pulsarotel.Setup(context.Background(),
+		pulsarotel.WithLogger(logger),
+		pulsarotel.WithServiceName(cfg.Service.Name),
+		pulsarotel.WithServiceVersion(cfg.Service.Version),
+		pulsarotel.WithEnvironment(cfg.Service.Environment),
+		pulsarotel.WithProtocol(pulsarotel.Protocol(cfg.Telemetry.OTLPProtocol)),
+		pulsarotel.WithOTLPEndpoint(cfg.Telemetry.OTLPEndpoint),
+		pulsarotel.WithTracesProtocol(pulsarotel.Protocol(cfg.Telemetry.TracesProtocol)),
+		pulsarotel.WithTracesEndpoint(cfg.Telemetry.TracesEndpoint),
+		pulsarotel.WithMetricsProtocol(pulsarotel.Protocol(cfg.Telemetry.MetricsProtocol)),
+		pulsarotel.WithMetricsEndpoint(cfg.Telemetry.MetricsEndpoint),
+		pulsarotel.WithLogsProtocol(pulsarotel.Protocol(cfg.Telemetry.LogsProtocol)),
+		pulsarotel.WithLogsEndpoint(cfg.Telemetry.LogsEndpoint),
+		pulsarotel.WithInsecure(cfg.Telemetry.Insecure),
+		pulsarotel.WithHeaders(cfg.Telemetry.Headers),
+		pulsarotel.WithPropagator(propagator),
+		pulsarotel.WithSampler(sampler),
+		pulsarotel.WithRespectMessageSampling(cfg.Telemetry.RespectMessageSampling),
+		pulsarotel.WithBatchTimeout(cfg.Telemetry.TraceBatchTimeout),
+		pulsarotel.WithMaxExportBatchSize(cfg.Telemetry.TraceMaxBatchSize),
+		pulsarotel.WithMetricExportInterval(cfg.Telemetry.MetricExportInterval),
+		pulsarotel.WithMetricExportTimeout(cfg.Telemetry.MetricExportTimeout),
+		pulsarotel.WithSystemMetricsInterval(cfg.Telemetry.SystemMetricsInterval),
+		pulsarotel.WithPrometheus(cfg.Telemetry.Prometheus),
+		pulsarotel.WithMetricNames(pulsarotel.MetricNames(cfg.Telemetry.MetricNames)),
+		pulsarotel.WithPulsarURL(cfg.Pulsar.URL),
+		pulsarotel.WithExportFailureThreshold(cfg.Admin.ExportFailures),
+	)
 	if err != nil {
-		logger.Fatal("Failed to initialize meter provider", zap.Error(err))
+		logger.Fatal("Failed to initialize telemetry", zap.Error(err))
 	}
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := mp.Shutdown(ctx); err != nil {
-			logger.Error("Error shutting down meter provider", zap.Error(err))
+
+	// From now on log entries are also exported through the OpenTelemetry logs pipeline
+	logger = tel.Logger()
+
+	// Serve the Kubernetes probes while the Pulsar client connects
+	var (
+		producerRef  atomic.Pointer[pulsarotel.TracedProducer]
+		consumerRef  atomic.Pointer[pulsarotel.TracedConsumer]
+		consumerErr  atomic.Pointer[error]
+		shuttingDown atomic.Bool
+	)
+	var adminServer *admin.Server
+	if cfg.Admin.Enabled {
+		adminServer = admin.New(cfg.Admin.Addr, logger)
+		if produces {
+			adminServer.AddReadinessCheck("producer", func(context.Context) error {
+				if producerRef.Load() == nil {
+					return errors.New("producer not created")
+				}
+				return nil
+			})
 		}
-	}()
+		if consumes {
+			adminServer.AddReadinessCheck("consumer", func(context.Context) error {
+				if consumerRef.Load() == nil {
+					return errors.New("consumer not created")
+				}
+				if err := consumerErr.Load(); err != nil {
+					return fmt.Errorf("consumer stopped: %w", *err)
+				}
+				return nil
+			})
+		}
+		adminServer.AddReadinessCheck("telemetry", func(context.Context) error {
+			return tel.ExportError()
+		})
+		adminServer.AddReadinessCheck("shutdown", func(context.Context) error {
+			if shuttingDown.Load() {
+				return errors.New("shutting down")
+			}
+			return nil
+		})
+		adminServer.AddLivenessCheck("consume_loop", func(context.Context) error {
+			if consumer := consumerRef.Load(); consumer != nil {
+				return consumer.CheckProgress(cfg.Admin.StallThreshold)
+			}
+			return nil
+		})
+		if handler := tel.PrometheusHandler(); handler != nil {
+			adminServer.Handle("GET /metrics", handler)
+		}
+		if err := adminServer.Start(); err != nil {
+			logger.Fatal("Failed to start admin server", zap.Error(err))
+		}
+	}
 
 	// Create Pulsar client
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Start system metrics collection
-	go collectSystemMetrics(ctx)
-
-	// Get Pulsar configuration from environment or use defaults
-	pulsarURL := getEnvOrDefault("PULSAR_URL", "pulsar://localhost:6650")
-	authToken := os.Getenv("PULSAR_AUTH_TOKEN")
+	go tel.CollectSystemMetrics(ctx)
 
 	// Create Pulsar client options
 	clientOptions := pulsar.ClientOptions{
-		URL:               pulsarURL,
-		OperationTimeout:  30 * time.Second,
-		ConnectionTimeout: 30 * time.Second,
+		URL:               cfg.Pulsar.URL,
+		OperationTimeout:  cfg.Pulsar.OperationTimeout,
+		ConnectionTimeout: cfg.Pulsar.ConnectionTimeout,
 	}
 
-	// Add token authentication if provided
-	if authToken != "" {
-		clientOptions.Authentication = pulsar.NewAuthenticationToken(authToken)
+	// Verify pulsar+ssl:// brokers against the configured CA, the admin API
+	// calls over https:// share the same trust and client certificate
+	var adminTLS *tls.Config
+	if tlsCfg := cfg.Pulsar.TLS; strings.HasPrefix(cfg.Pulsar.URL, "pulsar+ssl://") {
+		clientOptions.TLSTrustCertsFilePath = tlsCfg.TrustCertsFile
+		clientOptions.TLSValidateHostname = tlsCfg.ValidateHostname
+		clientOptions.TLSAllowInsecureConnection = tlsCfg.AllowInsecure
+		logger.Info("Using TLS",
+			zap.String("trust_certs_file", tlsCfg.TrustCertsFile),
+			zap.Bool("validate_hostname", tlsCfg.ValidateHostname),
+			zap.Bool("allow_insecure", tlsCfg.AllowInsecure))
+		adminTLS = &tls.Config{MinVersion: tls.VersionTLS12}
+
+		// Watch the certificates for rotation and expiry
+		if tlsCfg.CertFile != "" || tlsCfg.TrustCertsFile != "" {
+			certs, err := tel.NewCertificateReloader(tlsCfg.CertFile, tlsCfg.KeyFile,
+				pulsarotel.WithTrustCertsFile(tlsCfg.TrustCertsFile),
+				pulsarotel.WithReloadInterval(tlsCfg.ReloadInterval),
+			)
+			if err != nil {
+				logger.Fatal("Failed to load TLS certificates", zap.Error(err))
+			}
+			go certs.Run(ctx)
+			if adminTLS, err = certs.TLSConfig(); err != nil {
+				logger.Fatal("Failed to load TLS certificates", zap.Error(err))
+			}
+			if tlsCfg.CertFile != "" {
+				clientOptions.Authentication = certs.Authentication()
+				logger.Info("Using TLS client certificate authentication", zap.String("cert_file", tlsCfg.CertFile))
+			}
+		}
+		adminTLS.InsecureSkipVerify = tlsCfg.AllowInsecure
+	}
+
+	// Add token authentication if provided, the admin API calls use the same token
+	statsOptions := []pulsarotel.TopicStatsOption{
+		pulsarotel.WithStatsInterval(cfg.Telemetry.TopicStatsInterval),
+	}
+	if adminTLS != nil && strings.HasPrefix(cfg.Pulsar.AdminURL, "https://") {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = adminTLS
+		statsOptions = append(statsOptions, pulsarotel.WithStatsHTTPClient(&http.Client{
+			Timeout:   10 * time.Second,
+			Transport: transport,
+		}))
+	}
+	switch {
+	case clientOptions.Authentication != nil:
+	case cfg.Pulsar.OAuth2.PrivateKeyFile != "":
+		oauth2Cfg := cfg.Pulsar.OAuth2
+		tokens, err := tel.NewOAuth2TokenSource(oauth2Cfg.IssuerURL, oauth2Cfg.Audience, oauth2Cfg.PrivateKeyFile,
+			pulsarotel.WithOAuth2Scope(oauth2Cfg.Scope))
+		if err != nil {
+			logger.Fatal("Failed to obtain OAuth2 token", zap.Error(err))
+		}
+		clientOptions.Authentication = tokens.Authentication()
+		statsOptions = append(statsOptions, pulsarotel.WithStatsTokenSupplier(tokens.Token))
+		logger.Info("Using OAuth2 client credentials authentication", zap.String("issuer_url", oauth2Cfg.IssuerURL))
+	case cfg.Pulsar.AuthTokenFile != "":
+		tokens, err := tel.NewFileTokenSource(cfg.Pulsar.AuthTokenFile)
+		if err != nil {
+			logger.Fatal("Failed to read token file", zap.Error(err))
+		}
+		clientOptions.Authentication = tokens.Authentication()
+		statsOptions = append(statsOptions, pulsarotel.WithStatsTokenSupplier(tokens.Token))
+		logger.Info("Using token file authentication", zap.String("path", cfg.Pulsar.AuthTokenFile))
+	case cfg.Pulsar.AuthToken != "":
+		clientOptions.Authentication = pulsar.NewAuthenticationToken(cfg.Pulsar.AuthToken)
+		statsOptions = append(statsOptions, pulsarotel.WithStatsAuthToken(cfg.Pulsar.AuthToken))
 		logger.Info("Using token authentication")
-	} else {
+	default:
 		logger.Info("No authentication token provided, using anonymous access")
 	}
 
@@ -118,499 +244,231 @@ func main() {
 	if err != nil {
 		logger.Fatal("Failed to create Pulsar client", zap.Error(err))
 	}
-	defer client.Close()
 
 	// Record connection metric
-	recordConnectionChange(ctx, 1, pulsarURL)
-	defer recordConnectionChange(ctx, -1, pulsarURL)
-
-	// Create a Pulsar producer with tracing
-	producer, err := createTracedProducer(ctx, client)
-	if err != nil {
-		logger.Fatal("Failed to create producer", zap.Error(err))
-	}
-	defer producer.Close()
+	tel.RecordConnectionChange(ctx, 1, cfg.Pulsar.URL)
 
-	// Create a Pulsar consumer with tracing
-	consumer, err := createTracedConsumer(ctx, client)
+	// Encode the payloads declared in async-spec.yml with the configured schema
+	codec, err := events.NewMessageCodec(cfg.Pulsar.Codec)
 	if err != nil {
-		logger.Fatal("Failed to create consumer", zap.Error(err))
+		logger.Fatal("Failed to create payload codec", zap.Error(err))
 	}
-	defer consumer.Close()
-
-	// Set up signal handling for graceful shutdown
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt)
 
-	// Start a goroutine for producing messages
-	go produceMessages(ctx, producer)
-
-	// Start a goroutine for consuming messages
-	go consumeMessages(ctx, consumer)
-
-	// Wait for interrupt signal
-	<-sigCh
-	logger.Info("Shutting down...")
-}
-
-func initLogger() (*zap.Logger, error) {
-	config := zap.NewDevelopmentConfig()
-	return config.Build()
-}
-
-func initTracer() (*sdktrace.TracerProvider, error) {
-	// Create a resource describing the service
-	res, err := resource.New(context.Background(),
-		resource.WithFromEnv(),
-		resource.WithAttributes(
-			// These attributes are added if not present in the environment
-			semconv.ServiceName(serviceName),
-			semconv.ServiceVersion(serviceVersion),
-			attribute.String("environment", "development"),
-		),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
-	}
-
-	// Check if OTLP endpoint is provided via env var
-	var exporter sdktrace.SpanExporter
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint != "" {
-		// Use OTLP exporter options
-		opts := []otlptracegrpc.Option{
-			otlptracegrpc.WithEndpoint(endpoint),
-		}
-
-		// Check if we need to use secure or insecure connection
-		if os.Getenv("OTEL_EXPORTER_OTLP_INSECURE") == "true" {
-			opts = append(opts, otlptracegrpc.WithInsecure())
-		}
-
-		// Add headers if provided
-		headers := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")
-		if headers != "" {
-			opts = append(opts, otlptracegrpc.WithHeaders(parseHeaders(headers)))
-		}
-
-		// Create the OTLP client and exporter
-		client := otlptracegrpc.NewClient(opts...)
-		exporter, err = otlptrace.New(context.Background(), client)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
-		}
-		logger.Info("Using OTLP exporter", zap.String("endpoint", endpoint))
-	} else {
-		// Fall back to stdout exporter
-		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	// Validate the payloads against their JSON Schema in async-spec.yml
+	var typedOptions []pulsarotel.TypedOption
+	if cfg.Pulsar.Contract != "off" {
+		contract, err := events.NewMessageContract(cfg.Pulsar.Contract == "strict")
 		if err != nil {
-			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+			logger.Fatal("Failed to create message contract", zap.Error(err))
 		}
-		logger.Info("Using stdout exporter")
+		typedOptions = append(typedOptions, pulsarotel.WithContract(contract))
 	}
 
-	// Create trace provider with the exporter
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter,
-			// Set a shorter batch timeout to see spans more quickly
-			sdktrace.WithBatchTimeout(5*time.Second),
-			sdktrace.WithMaxExportBatchSize(10),
-		),
-		sdktrace.WithResource(res),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-	)
-
-	// Set the global trace provider and propagator
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{},
-		propagation.Baggage{},
-	))
-
-	tracer = tp.Tracer(serviceName)
-	return tp, nil
-}
-
-// initMeter initializes the OpenTelemetry meter provider and instruments
-func initMeter() (*sdkmetric.MeterProvider, error) {
-	// Create a resource describing the service
-	res, err := resource.New(context.Background(),
-		resource.WithFromEnv(),
-		resource.WithAttributes(
-			// These attributes are added if not present in the environment
-			semconv.ServiceName(serviceName),
-			semconv.ServiceVersion(serviceVersion),
-			attribute.String("environment", "development"),
-		),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
-	}
-
-	// Check if OTLP endpoint is provided via env var
-	var reader sdkmetric.Reader
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint != "" {
-		// Use OTLP exporter
-		opts := []otlpmetricgrpc.Option{
-			otlpmetricgrpc.WithEndpoint(endpoint),
+	// Create the traced producer of the publishMessage operation
+	var producer *pulsarotel.TypedProducer[events.Message]
+	if produces {
+		producer, err = events.NewPublishMessageProducer(ctx, tel, client, pulsar.ProducerOptions{
+			Topic: cfg.Pulsar.Topic,
+			Name:  cfg.Producer.Name,
+		}, codec, typedOptions...)
+		if err != nil {
+			logger.Fatal("Failed to create producer", zap.Error(err))
 		}
+		producerRef.Store(producer.TracedProducer)
+	}
 
-		// Check if we need to use secure or insecure connection
-		if os.Getenv("OTEL_EXPORTER_OTLP_INSECURE") == "true" {
-			opts = append(opts, otlpmetricgrpc.WithInsecure())
+	// Create the traced consumer of the consumeMessage operation. The trace
+	// context travels in the message properties, so the process spans
+	// continue the traces of producers running in other processes.
+	var consumer *pulsarotel.TracedConsumer
+	if consumes {
+		consumerOptions := []pulsarotel.ConsumerOption{
+			pulsarotel.WithWorkers(cfg.Consumer.Workers),
+			pulsarotel.WithMaxInFlight(cfg.Consumer.MaxInFlight),
+			pulsarotel.WithKeyOrdering(cfg.Consumer.KeyOrdering),
+			pulsarotel.WithPropagationMode(pulsarotel.PropagationMode(cfg.Consumer.Propagation)),
+			pulsarotel.WithBaggageKeys(cfg.Consumer.BaggageKeys...),
 		}
-
-		// Add headers if provided
-		headers := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")
-		if headers != "" {
-			opts = append(opts, otlpmetricgrpc.WithHeaders(parseHeaders(headers)))
+		if retry := cfg.Consumer.Retry; retry.Enabled {
+			consumerOptions = append(consumerOptions, pulsarotel.WithRetryPolicy(pulsarotel.RetryPolicy{
+				MaxRetries:      uint32(retry.MaxRetries),
+				InitialBackoff:  retry.InitialBackoff,
+				MaxBackoff:      retry.MaxBackoff,
+				RetryTopic:      retry.RetryTopic,
+				DeadLetterTopic: retry.DeadLetterTopic,
+			}))
 		}
-
-		// Create the exporter
-		exporter, err := otlpmetricgrpc.New(context.Background(), opts...)
+		consumer, err = events.SubscribeConsumeMessage(ctx, tel, client, pulsar.ConsumerOptions{
+			Topic:            cfg.Pulsar.Topic,
+			SubscriptionName: cfg.Consumer.Subscription,
+			Type:             subscriptionType(cfg.Consumer.SubscriptionType),
+		}, codec, consumerOptions...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+			logger.Fatal("Failed to create consumer", zap.Error(err))
 		}
-
-		// Set a specific interval for the periodic reader to ensure metrics are pushed regularly
-		// 15 seconds matches our collection interval
-		reader = sdkmetric.NewPeriodicReader(exporter,
-			sdkmetric.WithInterval(15*time.Second),
-			sdkmetric.WithTimeout(10*time.Second),
-		)
-		logger.Info("Using OTLP metrics exporter",
-			zap.String("endpoint", endpoint),
-			zap.Duration("push_interval", 15*time.Second),
-		)
-	} else {
-		// Fall back to stdout exporter
-		exporter, err := stdoutmetric.New()
+		consumerRef.Store(consumer)
+	}
+	logger.Info("Running", zap.String("mode", cfg.Service.Mode))
+
+	// Poll the subscription backlog and topic rates from the Pulsar admin API
+	if cfg.Telemetry.TopicStats {
+		// Without a consumer there is no subscription to report on
+		var subscription string
+		if consumes {
+			subscription = cfg.Consumer.Subscription
+		}
+		stats, err := tel.NewTopicStatsCollector(cfg.Pulsar.AdminURL, cfg.Pulsar.Topic, subscription,
+			statsOptions...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create stdout metric exporter: %w", err)
+			logger.Fatal("Failed to create topic stats collector", zap.Error(err))
 		}
-		reader = sdkmetric.NewPeriodicReader(exporter,
-			sdkmetric.WithInterval(15*time.Second),
-			sdkmetric.WithTimeout(10*time.Second),
-		)
-		logger.Info("Using stdout metrics exporter", zap.Duration("push_interval", 15*time.Second))
+		go stats.Run(ctx)
 	}
 
-	// Create a new meter provider with the exporter
-	mp := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(reader),
-		sdkmetric.WithResource(res),
-		// Add view to ensure no aggregation issues
-		sdkmetric.WithView(sdkmetric.NewView(
-			sdkmetric.Instrument{Kind: sdkmetric.InstrumentKindUpDownCounter},
-			sdkmetric.Stream{Aggregation: sdkmetric.AggregationSum{}},
-		)),
-	)
-
-	// Set the global meter provider
-	otel.SetMeterProvider(mp)
-
-	// Register the meter
-	meter := mp.Meter(serviceName)
+	// Set up signal handling for graceful shutdown, Kubernetes sends SIGTERM
+	sigCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
 
-	// Create instruments
-	var err1, err2, err3, err4, err5 error
-	messagesPublished, err1 = meter.Int64Counter(
-		"pulsar.messages.published",
-		metric.WithDescription("Total number of messages published"),
-		metric.WithUnit("{messages}"),
-	)
-
-	messagesConsumed, err2 = meter.Int64Counter(
-		"pulsar.messages.consumed",
-		metric.WithDescription("Total number of messages consumed"),
-		metric.WithUnit("{messages}"),
-	)
-
-	messagePublishLatency, err3 = meter.Float64Histogram(
-		"pulsar.message.publish.latency",
-		metric.WithDescription("Latency of publishing messages"),
-		metric.WithUnit("ms"),
-	)
-
-	messageConsumeLatency, err4 = meter.Float64Histogram(
-		"pulsar.message.consume.latency",
-		metric.WithDescription("Latency of consuming messages"),
-		metric.WithUnit("ms"),
-	)
-
-	activePulsarConnections, err5 = meter.Int64UpDownCounter(
-		"pulsar.connections.active",
-		metric.WithDescription("Number of active connections to Pulsar"),
-		metric.WithUnit("{connections}"),
-	)
-
-	// Create system metrics for Elastic APM
-	var errCPU, errMemUsage, errMemTotal error
-
-	// CPU usage metric - using the system.cpu.usage name for Elastic APM compatibility
-	systemCPUUsage, errCPU = meter.Float64Gauge(
-		"system.cpu.usage",
-		metric.WithDescription("CPU usage percentage"),
-		metric.WithUnit("1"), // 1 means a ratio/percentage in OpenTelemetry
-	)
-
-	// Memory usage metrics - using names compatible with Elastic APM
-	systemMemoryUsage, errMemUsage = meter.Float64Gauge(
-		"system.memory.usage",
-		metric.WithDescription("Memory usage in bytes"),
-		metric.WithUnit("By"), // Bytes unit
-	)
-
-	systemMemoryTotal, errMemTotal = meter.Float64Gauge(
-		"system.memory.total",
-		metric.WithDescription("Total system memory in bytes"),
-		metric.WithUnit("By"), // Bytes unit
-	)
-
-	// Check for errors in creating instruments
-	for _, err := range []error{err1, err2, err3, err4, err5, errCPU, errMemUsage, errMemTotal} {
+	// Start a goroutine for producing messages, every interval or following
+	// the load profile, attaching the configured business context as baggage
+	produceCtx, stopProducing := context.WithCancel(ctx)
+	var producing sync.WaitGroup
+	if producer != nil {
+		produceCtx, err = pulsarotel.ContextWithBaggage(produceCtx, cfg.Producer.Baggage)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create instrument: %w", err)
+			logger.Fatal("Invalid producer baggage", zap.Error(err))
+		}
+		produce := func(ctx context.Context) {
+			produceMessages(ctx, producer, cfg.Producer.Interval)
 		}
+		if load := cfg.Producer.Load; load.Rate > 0 {
+			generator, err := pulsarotel.NewLoadGenerator(tel, producer, load.Profile(),
+				func(id string, content string) *events.Message {
+					return &events.Message{MessageID: id, Content: content}
+				})
+			if err != nil {
+				logger.Fatal("Failed to create load generator", zap.Error(err))
+			}
+			produce = generator.Run
+		}
+		producing.Add(1)
+		go func() {
+			defer producing.Done()
+			produce(produceCtx)
+		}()
 	}
 
-	return mp, nil
-}
-
-// Function to record metrics when publishing a message
-func recordPublishMetrics(ctx context.Context, duration time.Duration, topic string, success bool) {
-	// Record message published count with attributes properly wrapped
-	messagesPublished.Add(ctx, 1,
-		metric.WithAttributes(
-			attribute.String("topic", topic),
-			attribute.Bool("success", success),
-		),
-	)
-
-	// Record publish latency with attributes properly wrapped
-	messagePublishLatency.Record(ctx, float64(duration.Milliseconds()),
-		metric.WithAttributes(
-			attribute.String("topic", topic),
-			attribute.Bool("success", success),
-		),
-	)
-}
-
-// Function to record metrics when consuming a message
-func recordConsumeMetrics(ctx context.Context, duration time.Duration, topic string, subscription string) {
-	// Record message consumed count with attributes properly wrapped
-	messagesConsumed.Add(ctx, 1,
-		metric.WithAttributes(
-			attribute.String("topic", topic),
-			attribute.String("subscription", subscription),
-		),
-	)
-
-	// Record consume processing latency with attributes properly wrapped
-	messageConsumeLatency.Record(ctx, float64(duration.Milliseconds()),
-		metric.WithAttributes(
-			attribute.String("topic", topic),
-			attribute.String("subscription", subscription),
-		),
-	)
-}
-
-// Function to track connection state changes
-func recordConnectionChange(ctx context.Context, deltaConnections int64, host string) {
-	// Record connection change with attributes properly wrapped
-	activePulsarConnections.Add(ctx, deltaConnections,
-		metric.WithAttributes(
-			attribute.String("host", host),
-		),
-	)
-}
-
-// Function to collect system metrics periodically
-func collectSystemMetrics(ctx context.Context) {
-	ticker := time.NewTicker(15 * time.Second)
-	defer ticker.Stop()
-
-	hostAttributes := []attribute.KeyValue{
-		attribute.String("host.name", getHostname()),
+	// Start a goroutine for consuming messages
+	consumed := make(chan error, 1)
+	if consumer != nil {
+		go func() {
+			consumed <- consumer.Run(ctx, pulsarotel.DecodeHandler(tel, codec, newMessageHandler(cfg.Consumer.ProcessingDelay), typedOptions...))
+		}()
 	}
 
-	logger.Info("Starting system metrics collection", zap.Duration("interval", 15*time.Second))
-
-	// Collect metrics immediately on startup, then on ticker
-	collectAndRecordMetrics(ctx, hostAttributes)
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			collectAndRecordMetrics(ctx, hostAttributes)
+	// Wait for interrupt signal. A consumer stopping on its own fails the
+	// readiness probe instead of leaving the service silently idle.
+	select {
+	case <-sigCtx.Done():
+	case err := <-consumed:
+		if err == nil {
+			err = errors.New("consume loop returned")
 		}
+		consumerErr.Store(&err)
+		logger.Error("Consumer stopped", zap.Error(err))
+		<-sigCtx.Done()
 	}
-}
-
-// Helper function to collect and record metrics
-func collectAndRecordMetrics(ctx context.Context, hostAttributes []attribute.KeyValue) {
-	// Collect CPU usage
-	cpuPercent, err := cpu.Percent(0, false)
-	if err == nil && len(cpuPercent) > 0 {
-		// Convert to ratio (0.0-1.0) as per OpenTelemetry conventions
-		cpuRatio := cpuPercent[0] / 100.0
-		systemCPUUsage.Record(ctx, cpuRatio, metric.WithAttributes(hostAttributes...))
-		logger.Info("Recorded CPU usage", zap.Float64("usage_ratio", cpuRatio))
-	} else if err != nil {
-		logger.Error("Failed to collect CPU metrics", zap.Error(err))
-	}
-
-	// Collect memory usage
-	memInfo, err := mem.VirtualMemory()
-	if err == nil {
-		// Record memory usage in bytes
-		systemMemoryUsage.Record(ctx, float64(memInfo.Used), metric.WithAttributes(hostAttributes...))
-		systemMemoryTotal.Record(ctx, float64(memInfo.Total), metric.WithAttributes(hostAttributes...))
-		logger.Info("Recorded memory metrics",
-			zap.Uint64("used_bytes", memInfo.Used),
-			zap.Uint64("total_bytes", memInfo.Total),
-		)
-	} else {
-		logger.Error("Failed to collect memory metrics", zap.Error(err))
+	logger.Info("Shutting down...", zap.Duration("timeout", cfg.Service.ShutdownTimeout))
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Service.ShutdownTimeout)
+	defer cancelShutdown()
+	var shutdownErrs []error
+	shuttingDown.Store(true)
+
+	// 1. Stop producing, cancelling the sends in progress, and flush the
+	// messages buffered by the producer
+	stopProducing()
+	produced := make(chan struct{})
+	go func() {
+		producing.Wait()
+		close(produced)
+	}()
+	select {
+	case <-produced:
+	case <-shutdownCtx.Done():
+		shutdownErrs = append(shutdownErrs, fmt.Errorf("failed to stop producing: %w", shutdownCtx.Err()))
 	}
-}
-
-// Get hostname for metric attributes
-func getHostname() string {
-	hostname, err := os.Hostname()
-	if err != nil {
-		return "unknown"
+	var unflushed int64
+	if producer != nil {
+		if err := producer.FlushWithCtx(shutdownCtx); err != nil {
+			shutdownErrs = append(shutdownErrs, fmt.Errorf("failed to flush producer: %w", err))
+		}
+		unflushed = producer.Pending()
+		producer.Close()
 	}
-	return hostname
-}
 
-// Helper function to parse OTLP headers from string in format "key1=value1,key2=value2"
-func parseHeaders(headerString string) map[string]string {
-	headers := make(map[string]string)
-	// Simple parsing - in production you might want more robust parsing
-	for _, pair := range strings.Split(headerString, ",") {
-		parts := strings.SplitN(pair, "=", 2)
-		if len(parts) == 2 {
-			headers[parts[0]] = parts[1]
+	// 2. Stop receiving and let the in-flight handlers finish and ack
+	var dropped int
+	if consumer != nil {
+		dropped, err = consumer.Shutdown(shutdownCtx)
+		if err != nil {
+			shutdownErrs = append(shutdownErrs, fmt.Errorf("failed to drain consumer: %w", err))
 		}
+		consumer.Close()
 	}
-	return headers
-}
 
-// Helper function to get environment variable or default value
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
+	// 3. Close the Pulsar client
+	client.Close()
+	tel.RecordConnectionChange(ctx, -1, cfg.Pulsar.URL)
+	cancel()
 
-func createTracedProducer(ctx context.Context, client pulsar.Client) (pulsar.Producer, error) {
-	topic := getEnvOrDefault("PULSAR_TOPIC", "my-topic")
-	producerName := getEnvOrDefault("PULSAR_PRODUCER_NAME", "my-producer")
-
-	// Use messaging semantic conventions
-	ctx, span := tracer.Start(ctx, fmt.Sprintf("%s create_producer", topic),
-		trace.WithAttributes(
-			semconv.MessagingSystem("pulsar"),
-			semconv.MessagingDestinationName(topic),
-			attribute.String("pulsar.producer", producerName),
-		),
-	)
-	defer span.End()
-
-	logger.Info("Creating Pulsar producer",
-		zap.String("topic", topic),
-		zap.String("producer", producerName),
-		zap.String("trace_id", span.SpanContext().TraceID().String()),
-		zap.String("span_id", span.SpanContext().SpanID().String()))
-
-	producer, err := client.CreateProducer(pulsar.ProducerOptions{
-		Topic: topic,
-		Name:  producerName,
-	})
-	if err != nil {
-		span.RecordError(err)
-		return nil, err
+	// 4. Stop serving the probes
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			shutdownErrs = append(shutdownErrs, fmt.Errorf("failed to stop admin server: %w", err))
+		}
 	}
 
-	return producer, nil
-}
-
-func createTracedConsumer(ctx context.Context, client pulsar.Client) (pulsar.Consumer, error) {
-	topic := getEnvOrDefault("PULSAR_TOPIC", "my-topic")
-	subscription := getEnvOrDefault("PULSAR_SUBSCRIPTION", "my-subscription")
-
-	// Use messaging semantic conventions
-	ctx, span := tracer.Start(ctx, fmt.Sprintf("%s create_consumer", topic),
-		trace.WithAttributes(
-			semconv.MessagingSystem("pulsar"),
-			semconv.MessagingDestinationName(topic),
-			attribute.String("pulsar.subscription", subscription),
-		),
-	)
-	defer span.End()
-
-	logger.Info("Creating Pulsar consumer",
-		zap.String("topic", topic),
-		zap.String("subscription", subscription),
-		zap.String("trace_id", span.SpanContext().TraceID().String()),
-		zap.String("span_id", span.SpanContext().SpanID().String()))
-
-	consumer, err := client.Subscribe(pulsar.ConsumerOptions{
-		Topic:            topic,
-		SubscriptionName: subscription,
-		Type:             pulsar.Shared,
-	})
-	if err != nil {
-		span.RecordError(err)
-		return nil, err
+	// 5. Export the remaining telemetry
+	if err := tel.ForceFlush(shutdownCtx); err != nil {
+		shutdownErrs = append(shutdownErrs, err)
 	}
-
-	return consumer, nil
-}
-
-// InjectTraceContext injects the trace context into the message properties
-func injectTraceContext(ctx context.Context, properties map[string]string) map[string]string {
-	if properties == nil {
-		properties = make(map[string]string)
+	if err := tel.Shutdown(shutdownCtx); err != nil {
+		shutdownErrs = append(shutdownErrs, err)
 	}
-	// Use the OpenTelemetry propagator to inject trace context
-	otel.GetTextMapPropagator().Inject(ctx, propagationMapCarrier(properties))
-
-	return properties
-}
-
-// ExtractTraceContext extracts the trace context from message properties
-// and returns a new context with the extracted span context
-func extractTraceContext(ctx context.Context, properties map[string]string) context.Context {
-	return otel.GetTextMapPropagator().Extract(ctx, propagationMapCarrier(properties))
-}
 
-// propagationMapCarrier adapts a string map to the TextMapCarrier interface
-type propagationMapCarrier map[string]string
-
-func (c propagationMapCarrier) Get(key string) string {
-	return c[key]
+	if len(shutdownErrs) > 0 {
+		logger.Error("Shutdown incomplete",
+			zap.Int64("unflushed_messages", unflushed),
+			zap.Int("dropped_messages", dropped),
+			zap.Error(errors.Join(shutdownErrs...)))
+		return
+	}
+	logger.Info("Shutdown complete")
 }
 
-func (c propagationMapCarrier) Set(key string, value string) {
-	c[key] = value
+func initLogger() (*zap.Logger, error) {
+	config := zap.NewDevelopmentConfig()
+	return config.Build()
 }
 
-func (c propagationMapCarrier) Keys() []string {
-	keys := make([]string, 0, len(c))
-	for k := range c {
-		keys = append(keys, k)
+// subscriptionType maps a validated config.ConsumerConfig.SubscriptionType
+// to the Pulsar subscription type
+func subscriptionType(name string) pulsar.SubscriptionType {
+	switch name {
+	case "exclusive":
+		return pulsar.Exclusive
+	case "failover":
+		return pulsar.Failover
+	case "key_shared":
+		return pulsar.KeyShared
+	default:
+		return pulsar.Shared
 	}
-	return keys
 }
 
-func produceMessages(ctx context.Context, producer pulsar.Producer) {
-	ticker := time.NewTicker(2 * time.Second)
+func produceMessages(ctx context.Context, producer *pulsarotel.TypedProducer[events.Message], interval time.Duration) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	msgCount := 0
@@ -621,128 +479,55 @@ func produceMessages(ctx context.Context, producer pulsar.Producer) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			startTime := time.Now()
-
 			msgCount++
 			msgId := fmt.Sprintf("msg-%d", msgCount)
 			message := fmt.Sprintf("Hello, OpenTelemetry! Message %d", msgCount)
 
-			// Create span with proper name and attributes
-			msgCtx, span := tracer.Start(ctx, fmt.Sprintf("%s publish", topic),
-				trace.WithAttributes(
-					semconv.MessagingSystem("pulsar"),
-					semconv.MessagingOperationPublish,
-					semconv.MessagingMessageID(msgId),
-					semconv.MessagingDestinationName(topic),
-				),
-			)
-
-			// Base message properties
-			properties := map[string]string{
-				"message_id": msgId,
-			}
-
-			// Ensure trace context is properly injected
-			properties = injectTraceContext(msgCtx, properties)
-
 			logger.Info("Producing message",
 				zap.String("message_id", msgId),
 				zap.String("content", message),
-				zap.String("topic", topic),
-				zap.String("trace_id", span.SpanContext().TraceID().String()),
-				zap.String("span_id", span.SpanContext().SpanID().String()))
-
-			// Send message with trace context
-			msgID, err := producer.Send(msgCtx, &pulsar.ProducerMessage{
-				Payload:    []byte(message),
-				Properties: properties,
-			})
-
-			// Record metrics
-			duration := time.Since(startTime)
-			success := err == nil
-			recordPublishMetrics(ctx, duration, topic, success)
+				zap.String("topic", topic))
 
+			// Every message also carries its own order id as baggage
+			msgCtx, err := pulsarotel.ContextWithBaggage(ctx, map[string]string{
+				pulsarotel.BaggageOrderID: msgId,
+			})
 			if err != nil {
-				logger.Error("Failed to publish message", zap.Error(err))
-				span.RecordError(err)
-				span.SetStatus(codes.Error, "Failed to publish message")
-			} else {
-				logger.Info("Published message",
-					zap.String("messageID", msgID.String()),
-					zap.String("trace_id", span.SpanContext().TraceID().String()),
-					zap.String("span_id", span.SpanContext().SpanID().String()))
-				span.SetAttributes(attribute.String("pulsar.message_id", msgID.String()))
+				logger.Error("Invalid message baggage", zap.Error(err))
+				continue
 			}
 
-			span.End()
+			// The traced producer creates the publish span, encodes the
+			// payload, injects the trace context and baggage and records the
+			// publish metrics. The send is cancelled when shutdown starts.
+			payload := &events.Message{MessageID: msgId, Content: message}
+			_, _ = producer.SendValue(msgCtx, payload, &pulsar.ProducerMessage{
+				Properties: map[string]string{
+					"message_id": msgId,
+				},
+			})
 		}
 	}
 }
 
-func consumeMessages(ctx context.Context, consumer pulsar.Consumer) {
-	// Get topic and subscription from environment variables directly
-	topic := getEnvOrDefault("PULSAR_TOPIC", "my-topic")
-	subscription := getEnvOrDefault("PULSAR_SUBSCRIPTION", "my-subscription")
-
-	logger.Info("Starting consumer",
-		zap.String("topic", topic),
-		zap.String("subscription", subscription))
-
-	for {
+// newMessageHandler returns the demo business logic run by the traced
+// consumer for every received message, once its payload is decoded
+func newMessageHandler(processingDelay time.Duration) pulsarotel.TypedHandler[events.Message] {
+	return func(ctx context.Context, msg pulsar.Message, payload *events.Message) error {
+		// Process the message
+		logger.Info("Received message",
+			zap.String("messageID", msg.ID().String()),
+			zap.String("message_id", payload.MessageID),
+			zap.String("content", payload.Content),
+			zap.String("topic", msg.Topic()),
+			pulsarotel.ContextField(ctx))
+
+		// Simulate processing time, giving up when the consumer shuts down
 		select {
+		case <-time.After(processingDelay):
 		case <-ctx.Done():
-			return
-		default:
-			startTime := time.Now()
-			msg, err := consumer.Receive(ctx)
-			if err != nil {
-				logger.Error("Error receiving message", zap.Error(err))
-				continue
-			}
-
-			properties := msg.Properties()
-			msgID := "unknown"
-			if id, ok := properties["message_id"]; ok {
-				msgID = id
-			}
-
-			// Extract trace context from message properties
-			msgCtx := extractTraceContext(ctx, properties)
-
-			// Create process span with proper name and attributes
-			msgCtx, span := tracer.Start(msgCtx, fmt.Sprintf("%s process", topic),
-				trace.WithAttributes(
-					semconv.MessagingSystem("pulsar"),
-					semconv.MessagingOperationProcess,
-					semconv.MessagingMessageID(msgID),
-					semconv.MessagingDestinationName(topic),
-					attribute.String("pulsar.subscription", subscription),
-					attribute.String("pulsar.message_id", msg.ID().String()),
-				),
-			)
-
-			// Process the message
-			data := string(msg.Payload())
-			logger.Info("Received message",
-				zap.String("messageID", msg.ID().String()),
-				zap.String("content", data),
-				zap.String("topic", topic),
-				zap.String("trace_id", span.SpanContext().TraceID().String()),
-				zap.String("span_id", span.SpanContext().SpanID().String()))
-
-			// Acknowledge the message
-			consumer.Ack(msg)
-
-			// Record metrics
-			duration := time.Since(startTime)
-			recordConsumeMetrics(ctx, duration, topic, subscription)
-
-			span.AddEvent("message acknowledged")
-			span.End()
-
-			// Simulate processing time
-			time.Sleep(500 * time.Millisecond)
+			return ctx.Err()
 		}
+		return nil
 	}
 }
@@ -0,0 +1,370 @@
+package pulsarotel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// Token sources recorded in the method attribute of pulsar.auth.token.refreshes
+const (
+	authMethodOAuth2 = "oauth2"
+	authMethodFile   = "file"
+)
+
+// defaultOAuth2TokenLifetime is the lifetime assumed for a token granted
+// without expires_in, which the OAuth2 specification makes optional
+const defaultOAuth2TokenLifetime = time.Hour
+
+// OAuth2TokenSource obtains the tokens authenticating the Pulsar connection
+// with the OAuth2 client credentials grant, and requests a new one shortly
+// before the current one expires. The private key file has the format used by
+// the Pulsar clients:
+//
+//	{"type": "client_credentials", "client_id": "...", "client_secret": "..."}
+//
+// It is read again for every token request, so that rotated credentials are
+// picked up. Every request is counted in pulsar.auth.token.refreshes.
+type OAuth2TokenSource struct {
+	tel            *Telemetry
+	issuerURL      string
+	audience       string
+	scope          string
+	privateKeyFile string
+	client         *http.Client
+	refreshMargin  time.Duration
+
+	// tokenEndpoint is only used by the refresh in flight
+	tokenEndpoint string
+
+	mu      sync.Mutex
+	token   string
+	expiry  time.Time
+	refresh *tokenRefresh
+}
+
+// tokenRefresh is a token request in flight, shared by the callers needing
+// a new token
+type tokenRefresh struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// OAuth2Option configures an OAuth2TokenSource
+type OAuth2Option func(*OAuth2TokenSource)
+
+// WithOAuth2Scope sets the scope requested with the tokens
+func WithOAuth2Scope(scope string) OAuth2Option {
+	return func(s *OAuth2TokenSource) {
+		s.scope = scope
+	}
+}
+
+// WithOAuth2HTTPClient sets the HTTP client calling the issuer
+func WithOAuth2HTTPClient(client *http.Client) OAuth2Option {
+	return func(s *OAuth2TokenSource) {
+		s.client = client
+	}
+}
+
+// WithOAuth2RefreshMargin sets how long before its expiry a token is replaced,
+// defaults to 1 minute
+func WithOAuth2RefreshMargin(margin time.Duration) OAuth2Option {
+	return func(s *OAuth2TokenSource) {
+		s.refreshMargin = margin
+	}
+}
+
+// NewOAuth2TokenSource creates a token source for the issuer at issuerURL,
+// whose token endpoint is discovered from its
+// .well-known/openid-configuration document, and requests a first token
+func (t *Telemetry) NewOAuth2TokenSource(issuerURL, audience, privateKeyFile string, opts ...OAuth2Option) (*OAuth2TokenSource, error) {
+	if _, err := url.Parse(issuerURL); err != nil || issuerURL == "" {
+		return nil, fmt.Errorf("invalid OAuth2 issuer URL %q", issuerURL)
+	}
+	s := &OAuth2TokenSource{
+		tel:            t,
+		issuerURL:      strings.TrimSuffix(issuerURL, "/"),
+		audience:       audience,
+		privateKeyFile: privateKeyFile,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		refreshMargin:  time.Minute,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if _, err := s.Token(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Authentication returns the Pulsar token authentication using the source
+func (s *OAuth2TokenSource) Authentication() pulsar.Authentication {
+	return pulsar.NewAuthenticationTokenFromSupplier(s.Token)
+}
+
+// Token returns the current access token, requesting a new one when it
+// expires within the refresh margin. A single request is in flight at a time:
+// the other callers get the current token while it has not expired, or wait
+// for the result of that request. When the request fails the current token
+// is returned as long as it has not expired.
+func (s *OAuth2TokenSource) Token() (string, error) {
+	s.mu.Lock()
+	now := time.Now()
+	if s.token != "" && now.Before(s.expiry.Add(-s.refreshMargin)) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	refresh := s.refresh
+	switch {
+	case refresh == nil:
+		refresh = &tokenRefresh{done: make(chan struct{})}
+		s.refresh = refresh
+		s.mu.Unlock()
+		s.refreshToken(refresh)
+	case s.token != "" && now.Before(s.expiry):
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	default:
+		s.mu.Unlock()
+	}
+	<-refresh.done
+	return refresh.token, refresh.err
+}
+
+// refreshToken requests a new token without holding the lock, then stores it
+// and hands the outcome to the callers waiting for refresh
+func (s *OAuth2TokenSource) refreshToken(refresh *tokenRefresh) {
+	ctx := context.Background()
+	start := time.Now()
+	token, expiresIn, err := s.requestToken(ctx)
+	s.tel.recordTokenRefresh(ctx, authMethodOAuth2, err == nil)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer close(refresh.done)
+	s.refresh = nil
+
+	if err != nil {
+		s.tel.logger.Warn("Failed to refresh OAuth2 token",
+			zap.String("issuer_url", s.issuerURL),
+			zap.Error(err))
+		if s.token != "" && time.Now().Before(s.expiry) {
+			refresh.token = s.token
+			return
+		}
+		refresh.err = err
+		return
+	}
+
+	s.token = token
+	s.expiry = start.Add(expiresIn)
+	refresh.token = token
+	s.tel.logger.Debug("Refreshed OAuth2 token",
+		zap.String("issuer_url", s.issuerURL),
+		zap.Time("expiry", s.expiry))
+}
+
+// requestToken exchanges the client credentials for an access token and
+// returns it with its lifetime, defaultOAuth2TokenLifetime when the issuer
+// does not tell
+func (s *OAuth2TokenSource) requestToken(ctx context.Context) (string, time.Duration, error) {
+	key, err := readOAuth2KeyFile(s.privateKeyFile)
+	if err != nil {
+		return "", 0, err
+	}
+	if s.tokenEndpoint == "" {
+		if s.tokenEndpoint, err = s.discoverTokenEndpoint(ctx); err != nil {
+			return "", 0, err
+		}
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", key.ClientID)
+	form.Set("client_secret", key.ClientSecret)
+	if s.audience != "" {
+		form.Set("audience", s.audience)
+	}
+	if s.scope != "" {
+		form.Set("scope", s.scope)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := s.do(req, &resp); err != nil {
+		return "", 0, err
+	}
+	if resp.AccessToken == "" {
+		return "", 0, errors.New("OAuth2 token response has no access_token")
+	}
+	if resp.ExpiresIn <= 0 {
+		return resp.AccessToken, defaultOAuth2TokenLifetime, nil
+	}
+	return resp.AccessToken, time.Duration(resp.ExpiresIn) * time.Second, nil
+}
+
+// discoverTokenEndpoint reads the token endpoint from the OpenID
+// configuration of the issuer
+func (s *OAuth2TokenSource) discoverTokenEndpoint(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.issuerURL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return "", err
+	}
+	var config struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := s.do(req, &config); err != nil {
+		return "", fmt.Errorf("failed to discover the OAuth2 token endpoint: %w", err)
+	}
+	if config.TokenEndpoint == "" {
+		return "", errors.New("OAuth2 issuer does not advertise a token_endpoint")
+	}
+	return config.TokenEndpoint, nil
+}
+
+// do sends req and decodes the JSON response into v
+func (s *OAuth2TokenSource) do(req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call OAuth2 issuer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("OAuth2 issuer %s returned %s: %s", req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode OAuth2 issuer response: %w", err)
+	}
+	return nil
+}
+
+// oauth2KeyFile holds the client credentials of a private key file
+type oauth2KeyFile struct {
+	Type         string `json:"type"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// readOAuth2KeyFile reads the client credentials from path
+func readOAuth2KeyFile(path string) (*oauth2KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OAuth2 private key: %w", err)
+	}
+	var key oauth2KeyFile
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid OAuth2 private key %s: %w", path, err)
+	}
+	if key.Type != "" && key.Type != "client_credentials" {
+		return nil, fmt.Errorf("OAuth2 private key %s has type %q, want client_credentials", path, key.Type)
+	}
+	if key.ClientID == "" || key.ClientSecret == "" {
+		return nil, fmt.Errorf("OAuth2 private key %s must set client_id and client_secret", path)
+	}
+	return &key, nil
+}
+
+// FileTokenSource reads the token authenticating the Pulsar connection from a
+// file, such as a mounted Kubernetes secret, and reads it again whenever the
+// file is modified so that a rotated token is used without a restart. Every
+// read is counted in pulsar.auth.token.refreshes.
+type FileTokenSource struct {
+	tel  *Telemetry
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+}
+
+// NewFileTokenSource creates a token source reading path, which must hold a
+// token
+func (t *Telemetry) NewFileTokenSource(path string) (*FileTokenSource, error) {
+	s := &FileTokenSource{tel: t, path: path}
+	if _, err := s.Token(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Authentication returns the Pulsar token authentication using the source
+func (s *FileTokenSource) Authentication() pulsar.Authentication {
+	return pulsar.NewAuthenticationTokenFromSupplier(s.Token)
+}
+
+// Token returns the token of the file, read again when the file was modified
+// since the last read. When the file cannot be read or is empty, the previous
+// token is returned.
+func (s *FileTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err == nil && s.token != "" && info.ModTime().Equal(s.modTime) {
+		return s.token, nil
+	}
+
+	var token string
+	if err == nil {
+		var data []byte
+		if data, err = os.ReadFile(s.path); err == nil {
+			if token = strings.TrimSpace(string(data)); token == "" {
+				err = fmt.Errorf("token file %s is empty", s.path)
+			}
+		}
+	}
+	ctx := context.Background()
+	s.tel.recordTokenRefresh(ctx, authMethodFile, err == nil)
+	if err != nil {
+		s.tel.logger.Warn("Failed to read token file", zap.String("path", s.path), zap.Error(err))
+		if s.token != "" {
+			return s.token, nil
+		}
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+
+	if s.token != "" {
+		s.tel.logger.Info("Reloaded token file", zap.String("path", s.path))
+	}
+	s.token = token
+	s.modTime = info.ModTime()
+	return s.token, nil
+}
+
+// recordTokenRefresh records an attempt to obtain a new token
+func (t *Telemetry) recordTokenRefresh(ctx context.Context, method string, success bool) {
+	t.metrics.tokenRefreshes.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("method", method),
+			attribute.Bool("success", success),
+		),
+	)
+}
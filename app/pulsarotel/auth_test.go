@@ -0,0 +1,244 @@
+package pulsarotel
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// stubIssuer is an OAuth2 issuer granting numbered tokens to the client
+// credentials of testKeyFile
+type stubIssuer struct {
+	*httptest.Server
+
+	expiresIn int64
+	requests  atomic.Int64
+	fail      atomic.Bool
+	// received counts the token requests, and release holds them when set
+	received atomic.Int64
+	release  chan struct{}
+}
+
+func newStubIssuer(t *testing.T, expiresIn int64) *stubIssuer {
+	t.Helper()
+
+	issuer := &stubIssuer{expiresIn: expiresIn}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"token_endpoint": issuer.URL + "/oauth/token"})
+	})
+	mux.HandleFunc("POST /oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		issuer.received.Add(1)
+		if issuer.release != nil {
+			<-issuer.release
+		}
+		if issuer.fail.Load() {
+			http.Error(w, `{"error":"server_error"}`, http.StatusInternalServerError)
+			return
+		}
+		if r.PostFormValue("grant_type") != "client_credentials" ||
+			r.PostFormValue("client_id") != "test-client" ||
+			r.PostFormValue("client_secret") != "test-secret" ||
+			r.PostFormValue("audience") != "urn:pulsar:test" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		n := issuer.requests.Add(1)
+		resp := map[string]any{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"token_type":   "Bearer",
+		}
+		// expires_in is optional, and left out when zero
+		if issuer.expiresIn != 0 {
+			resp["expires_in"] = issuer.expiresIn
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// testKeyFile writes a private key file with the client credentials accepted
+// by stubIssuer
+func testKeyFile(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "key.json")
+	key := `{"type":"client_credentials","client_id":"test-client","client_secret":"test-secret"}`
+	if err := os.WriteFile(path, []byte(key), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOAuth2TokenSourceCachesToken(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+	issuer := newStubIssuer(t, 3600)
+
+	source, err := tel.NewOAuth2TokenSource(issuer.URL, "urn:pulsar:test", testKeyFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		token, err := source.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "token-1" {
+			t.Errorf("token = %q, want the first token", token)
+		}
+	}
+	if got := issuer.requests.Load(); got != 1 {
+		t.Errorf("issuer granted %d tokens, want 1", got)
+	}
+}
+
+func TestOAuth2TokenSourceRefreshesToken(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+	// Tokens expire within the refresh margin, so every call refreshes
+	issuer := newStubIssuer(t, 30)
+
+	source, err := tel.NewOAuth2TokenSource(issuer.URL, "urn:pulsar:test", testKeyFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token-2" {
+		t.Errorf("token = %q, want a refreshed token", token)
+	}
+
+	// A failed refresh keeps the token until it expires
+	issuer.fail.Store(true)
+	if token, err = source.Token(); err != nil || token != "token-2" {
+		t.Errorf("token = %q, %v after a failed refresh, want the current token", token, err)
+	}
+	source.mu.Lock()
+	source.expiry = time.Now()
+	source.mu.Unlock()
+	if _, err := source.Token(); err == nil {
+		t.Error("expired token returned after a failed refresh, want an error")
+	}
+}
+
+func TestOAuth2TokenSourceRefreshesOnce(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+	issuer := newStubIssuer(t, 3600)
+
+	source, err := tel.NewOAuth2TokenSource(issuer.URL, "urn:pulsar:test", testKeyFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first token is due for a refresh but still valid
+	source.mu.Lock()
+	source.expiry = time.Now().Add(30 * time.Second)
+	source.mu.Unlock()
+	issuer.release = make(chan struct{})
+
+	tokens := make(chan string, 5)
+	for range cap(tokens) {
+		go func() {
+			token, err := source.Token()
+			if err != nil {
+				t.Error(err)
+			}
+			tokens <- token
+		}()
+	}
+	waitFor(t, "the refresh to reach the issuer", func() bool { return issuer.received.Load() == 2 })
+
+	// The callers not refreshing are not held by the refresh in flight
+	valid := 0
+	for range cap(tokens) - 1 {
+		if token := <-tokens; token == "token-1" {
+			valid++
+		}
+	}
+	if valid != cap(tokens)-1 {
+		t.Errorf("%d callers got the current token during the refresh, want %d", valid, cap(tokens)-1)
+	}
+
+	close(issuer.release)
+	if token := <-tokens; token != "token-2" {
+		t.Errorf("refreshing caller got %q, want token-2", token)
+	}
+	if got := issuer.received.Load(); got != 2 {
+		t.Errorf("issuer received %d token requests, want a single refresh", got)
+	}
+}
+
+func TestOAuth2TokenSourceDefaultsLifetime(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+	// The issuer leaves out expires_in
+	issuer := newStubIssuer(t, 0)
+
+	source, err := tel.NewOAuth2TokenSource(issuer.URL, "urn:pulsar:test", testKeyFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.mu.Lock()
+	lifetime := time.Until(source.expiry)
+	source.mu.Unlock()
+	if lifetime < defaultOAuth2TokenLifetime-time.Minute || lifetime > defaultOAuth2TokenLifetime {
+		t.Errorf("token lifetime = %s, want %s", lifetime, defaultOAuth2TokenLifetime)
+	}
+	if token, err := source.Token(); err != nil || token != "token-1" {
+		t.Errorf("token = %q, %v, want the cached token-1", token, err)
+	}
+}
+
+func TestOAuth2TokenSourceRejectsCredentials(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+	issuer := newStubIssuer(t, 3600)
+
+	if _, err := tel.NewOAuth2TokenSource(issuer.URL, "urn:pulsar:other", testKeyFile(t)); err == nil {
+		t.Error("token source created for an audience the issuer rejects, want an error")
+	}
+}
+
+func TestFileTokenSourceReadsRotatedToken(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := tel.NewFileTokenSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := source.Token(); token != "first" {
+		t.Errorf("token = %q, want %q", token, "first")
+	}
+
+	// Rotate the secret, with a distinct modification time
+	if err := os.WriteFile(path, []byte("second\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := source.Token(); token != "second" {
+		t.Errorf("token = %q after rotation, want %q", token, "second")
+	}
+
+	// A missing file keeps the previous token
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := source.Token(); err != nil || token != "second" {
+		t.Errorf("token = %q, %v with the file removed, want the previous token", token, err)
+	}
+}
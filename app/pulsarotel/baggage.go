@@ -0,0 +1,94 @@
+package pulsarotel
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.uber.org/zap"
+)
+
+// Baggage keys of the business context attached to messages at publish time
+const (
+	BaggageTenant        = "tenant.id"
+	BaggageOrderID       = "order.id"
+	BaggageRequestOrigin = "request.origin"
+)
+
+// ContextWithBaggage returns a copy of ctx whose baggage also holds members,
+// replacing the members with the same keys. Messages published with the
+// returned context carry the baggage in their properties, for consumers to
+// copy the keys they allowlist with WithBaggageKeys:
+//
+//	ctx, err := pulsarotel.ContextWithBaggage(ctx, map[string]string{
+//		pulsarotel.BaggageTenant:  "acme",
+//		pulsarotel.BaggageOrderID: orderID,
+//	})
+func ContextWithBaggage(ctx context.Context, members map[string]string) (context.Context, error) {
+	bag := baggage.FromContext(ctx)
+	for key, value := range members {
+		member, err := baggage.NewMemberRaw(key, value)
+		if err != nil {
+			return ctx, fmt.Errorf("invalid baggage member %q: %w", key, err)
+		}
+		if bag, err = bag.SetMember(member); err != nil {
+			return ctx, fmt.Errorf("invalid baggage member %q: %w", key, err)
+		}
+	}
+	return baggage.ContextWithBaggage(ctx, bag), nil
+}
+
+// WithBaggageKeys copies the baggage members with the listed keys from the
+// received messages onto the process span attributes, the fields of the log
+// entries written with ContextField and the consume metric attributes. Other
+// members are ignored so that producers cannot add arbitrary attributes, and
+// only low cardinality keys such as BaggageTenant should be listed to keep the
+// number of metric series bounded.
+func WithBaggageKeys(keys ...string) ConsumerOption {
+	return func(c *TracedConsumer) {
+		c.baggageKeys = keys
+	}
+}
+
+// baggageAttributes returns the allowlisted members of the baggage in ctx
+func (c *TracedConsumer) baggageAttributes(ctx context.Context) []attribute.KeyValue {
+	if len(c.baggageKeys) == 0 {
+		return nil
+	}
+	bag := baggage.FromContext(ctx)
+	var attrs []attribute.KeyValue
+	for _, key := range c.baggageKeys {
+		if member := bag.Member(key); member.Key() != "" {
+			attrs = append(attrs, attribute.String(key, member.Value()))
+		}
+	}
+	return attrs
+}
+
+// logFields turns attrs into string log fields
+func logFields(attrs []attribute.KeyValue) []zap.Field {
+	fields := make([]zap.Field, 0, len(attrs))
+	for _, attr := range attrs {
+		fields = append(fields, zap.String(string(attr.Key), attr.Value.Emit()))
+	}
+	return fields
+}
+
+// logFieldsKey is the context key of the fields added by ContextField
+type logFieldsKey struct{}
+
+// contextWithLogFields returns a copy of ctx whose ContextField log entries
+// also get fields
+func contextWithLogFields(ctx context.Context, fields []zap.Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, logFieldsKey{}, fields)
+}
+
+// logFieldsFromContext returns the fields added with contextWithLogFields
+func logFieldsFromContext(ctx context.Context) []zap.Field {
+	fields, _ := ctx.Value(logFieldsKey{}).([]zap.Field)
+	return fields
+}
@@ -0,0 +1,46 @@
+package pulsarotel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+)
+
+func TestProcessCopiesAllowlistedBaggage(t *testing.T) {
+	tel, recorder := newTestTelemetry(t, sdktrace.AlwaysSample())
+	consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic", WithBaggageKeys(BaggageTenant, BaggageRequestOrigin))
+
+	ctx, err := ContextWithBaggage(context.Background(), map[string]string{
+		BaggageTenant:  "acme",
+		BaggageOrderID: "order-42",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handlerFields []zap.Field
+	err = consumer.Process(context.Background(), fakeMessage{properties: InjectTraceContext(ctx, nil)},
+		func(ctx context.Context, msg pulsar.Message) error {
+			handlerFields = logFieldsFromContext(ctx)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := attribute.NewSet(processSpan(t, recorder).Attributes()...)
+	if got, _ := attrs.Value(BaggageTenant); got.AsString() != "acme" {
+		t.Errorf("%s attribute = %q, want %q", BaggageTenant, got.AsString(), "acme")
+	}
+	for _, key := range []attribute.Key{BaggageOrderID, BaggageRequestOrigin} {
+		if attrs.HasValue(key) {
+			t.Errorf("span has the %s attribute, want only the allowlisted baggage present", key)
+		}
+	}
+	if len(handlerFields) != 1 || !handlerFields[0].Equals(zap.String(BaggageTenant, "acme")) {
+		t.Errorf("handler log fields = %v, want %s=acme", handlerFields, BaggageTenant)
+	}
+}
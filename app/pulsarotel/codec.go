@@ -0,0 +1,186 @@
+package pulsarotel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// Codec names reported in the codec error metric
+const (
+	CodecJSON     = "json"
+	CodecAvro     = "avro"
+	CodecProtobuf = "protobuf"
+)
+
+// Codec encodes and decodes payloads of type T with a Pulsar schema. Pass
+// Schema in the producer and consumer options so that the broker registers
+// and checks the schema of the topic.
+type Codec[T any] interface {
+	// Name identifies the codec in metrics
+	Name() string
+	// Schema returns the Pulsar schema of the payload
+	Schema() pulsar.Schema
+	Encode(value *T) ([]byte, error)
+	Decode(data []byte, value *T) error
+}
+
+// schemaCodec implements Codec on top of a Pulsar schema
+type schemaCodec[T any] struct {
+	name   string
+	schema pulsar.Schema
+}
+
+func (c schemaCodec[T]) Name() string {
+	return c.name
+}
+
+func (c schemaCodec[T]) Schema() pulsar.Schema {
+	return c.schema
+}
+
+func (c schemaCodec[T]) Encode(value *T) ([]byte, error) {
+	return c.schema.Encode(value)
+}
+
+func (c schemaCodec[T]) Decode(data []byte, value *T) error {
+	return c.schema.Decode(data, value)
+}
+
+// NewJSONCodec returns a codec encoding T as JSON. Pulsar describes JSON
+// schemas with an Avro schema definition, given in avroSchemaDef.
+func NewJSONCodec[T any](avroSchemaDef string) (Codec[T], error) {
+	schema, err := pulsar.NewJSONSchemaWithValidation(avroSchemaDef, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema definition: %w", err)
+	}
+	return schemaCodec[T]{name: CodecJSON, schema: schema}, nil
+}
+
+// NewAvroCodec returns a codec encoding T as binary Avro with the schema
+// definition avroSchemaDef. Fields of T are mapped with avro struct tags.
+func NewAvroCodec[T any](avroSchemaDef string) (Codec[T], error) {
+	schema, err := pulsar.NewAvroSchemaWithValidation(avroSchemaDef, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema definition: %w", err)
+	}
+	return schemaCodec[T]{name: CodecAvro, schema: schema}, nil
+}
+
+// TypedOption configures a TypedProducer or a DecodeHandler
+type TypedOption func(*typedOptions)
+
+type typedOptions struct {
+	contract *Contract
+}
+
+// WithContract validates every payload against contract, after decoding on
+// the consumer side and before encoding on the producer side
+func WithContract(contract *Contract) TypedOption {
+	return func(o *typedOptions) {
+		o.contract = contract
+	}
+}
+
+func newTypedOptions(opts []TypedOption) typedOptions {
+	var o typedOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// TypedProducer publishes values of type T encoded with a Codec through a
+// TracedProducer. The producer should be created with the codec schema.
+type TypedProducer[T any] struct {
+	*TracedProducer
+
+	codec    Codec[T]
+	contract *Contract
+}
+
+// NewTypedProducer wraps producer to publish values encoded with codec
+func NewTypedProducer[T any](producer *TracedProducer, codec Codec[T], opts ...TypedOption) *TypedProducer[T] {
+	o := newTypedOptions(opts)
+	return &TypedProducer[T]{TracedProducer: producer, codec: codec, contract: o.contract}
+}
+
+// SendValue encodes value into msg inside the publish span and sends it like
+// TracedProducer.Send. msg carries the key, properties and other metadata and
+// may be nil. An encoding error, or a contract violation in strict mode,
+// fails the publish without sending.
+func (p *TypedProducer[T]) SendValue(ctx context.Context, value *T, msg *pulsar.ProducerMessage) (pulsar.MessageID, error) {
+	if msg == nil {
+		msg = &pulsar.ProducerMessage{}
+	}
+	return p.send(ctx, msg, p.encoder(value))
+}
+
+// SendValueAsync encodes value into msg inside the publish span and sends it
+// like TracedProducer.SendAsync
+func (p *TypedProducer[T]) SendValueAsync(ctx context.Context, value *T, msg *pulsar.ProducerMessage,
+	callback func(pulsar.MessageID, *pulsar.ProducerMessage, error)) {
+	if msg == nil {
+		msg = &pulsar.ProducerMessage{}
+	}
+	p.sendAsync(ctx, msg, p.encoder(value), callback)
+}
+
+// encoder returns the encodeFunc checking the contract of value and encoding
+// it, counting the encoding failures
+func (p *TypedProducer[T]) encoder(value *T) encodeFunc {
+	return func(ctx context.Context) ([]byte, error) {
+		if p.contract != nil {
+			document, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal %s payload for validation: %w", p.contract.message, err)
+			}
+			if err := p.contract.check(ctx, p.tel, p.Topic(), "publish", document); err != nil {
+				return nil, err
+			}
+		}
+		payload, err := p.codec.Encode(value)
+		if err != nil {
+			p.tel.RecordCodecError(ctx, p.Topic(), "encode", p.codec.Name())
+			return nil, fmt.Errorf("failed to encode %s payload: %w", p.codec.Name(), err)
+		}
+		return payload, nil
+	}
+}
+
+// TypedHandler processes a message together with its decoded payload
+type TypedHandler[T any] func(ctx context.Context, msg pulsar.Message, value *T) error
+
+// DecodeHandler returns a Handler decoding the payload with codec inside the
+// process span before calling handler. A payload that cannot be decoded is
+// counted in the codec error metric and fails the message like a handler
+// error, so it is recorded on the process span and nacked or retried. With
+// WithContract the decoded payload is validated as well; JSON payloads are
+// validated as received, others after a round trip through encoding/json. A
+// violation in strict mode returns an error wrapping ErrContractViolation,
+// which the TracedConsumer treats as permanent instead of retrying it.
+func DecodeHandler[T any](t *Telemetry, codec Codec[T], handler TypedHandler[T], opts ...TypedOption) Handler {
+	o := newTypedOptions(opts)
+	return func(ctx context.Context, msg pulsar.Message) error {
+		value := new(T)
+		if err := codec.Decode(msg.Payload(), value); err != nil {
+			t.RecordCodecError(ctx, msg.Topic(), "decode", codec.Name())
+			return fmt.Errorf("failed to decode %s payload: %w", codec.Name(), err)
+		}
+		if o.contract != nil {
+			document := msg.Payload()
+			if codec.Name() != CodecJSON {
+				var err error
+				if document, err = json.Marshal(value); err != nil {
+					return fmt.Errorf("failed to marshal %s payload for validation: %w", o.contract.message, err)
+				}
+			}
+			if err := o.contract.check(ctx, t, msg.Topic(), "process", document); err != nil {
+				return err
+			}
+		}
+		return handler(ctx, msg, value)
+	}
+}
@@ -0,0 +1,362 @@
+package pulsarotel
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// codecValue is a payload mapped to both its JSON and Avro fields
+type codecValue struct {
+	ID      string `json:"id" avro:"id"`
+	Content string `json:"content" avro:"content"`
+}
+
+const codecValueSchema = `{"type":"record","name":"CodecValue","fields":[` +
+	`{"name":"id","type":"string"},{"name":"content","type":"string"}]}`
+
+const codecValueJSONSchema = `{"type":"object","required":["id","content"],` +
+	`"properties":{"id":{"type":"string","minLength":1},"content":{"type":"string"}}}`
+
+// payloadMessage is a fakeMessage carrying payload
+type payloadMessage struct {
+	fakeMessage
+
+	payload []byte
+}
+
+func (m payloadMessage) Payload() []byte { return m.payload }
+func (payloadMessage) Topic() string     { return "test-topic" }
+
+func TestCodecRoundTrip(t *testing.T) {
+	codecs := map[string]func() (Codec[codecValue], error){
+		CodecJSON: func() (Codec[codecValue], error) { return NewJSONCodec[codecValue](codecValueSchema) },
+		CodecAvro: func() (Codec[codecValue], error) { return NewAvroCodec[codecValue](codecValueSchema) },
+		CodecProtobuf: func() (Codec[codecValue], error) {
+			return NewProtoRecordCodec[codecValue](codecValueSchema)
+		},
+	}
+	for name, newCodec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+			codec, err := newCodec()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if codec.Name() != name {
+				t.Errorf("codec name = %q, want %q", codec.Name(), name)
+			}
+
+			fake := &fakeProducer{}
+			producer := NewTypedProducer(tel.NewTracedProducer(fake), codec)
+			sent := codecValue{ID: "msg-1", Content: "hello"}
+			if _, err := producer.SendValue(context.Background(), &sent, nil); err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.messages) != 1 {
+				t.Fatalf("sent %d messages, want 1", len(fake.messages))
+			}
+
+			var received *codecValue
+			consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic")
+			err = consumer.Process(context.Background(), payloadMessage{payload: fake.messages[0].Payload},
+				DecodeHandler(tel, codec, func(ctx context.Context, msg pulsar.Message, value *codecValue) error {
+					received = value
+					return nil
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if received == nil || *received != sent {
+				t.Errorf("received %+v, want %+v", received, sent)
+			}
+		})
+	}
+}
+
+func TestProtoCodecRoundTrip(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+	codec := NewProtoCodec[wrapperspb.StringValue]()
+	if codec.Name() != CodecProtobuf {
+		t.Errorf("codec name = %q, want %q", codec.Name(), CodecProtobuf)
+	}
+	if got := codec.Schema().GetSchemaInfo().Type; got != pulsar.ProtoNative {
+		t.Errorf("schema type = %v, want %v", got, pulsar.ProtoNative)
+	}
+
+	fake := &fakeProducer{}
+	producer := NewTypedProducer(tel.NewTracedProducer(fake), codec)
+	if _, err := producer.SendValue(context.Background(), wrapperspb.String("hello"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var received *wrapperspb.StringValue
+	consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic")
+	err := consumer.Process(context.Background(), payloadMessage{payload: fake.messages[0].Payload},
+		DecodeHandler(tel, codec, func(ctx context.Context, msg pulsar.Message, value *wrapperspb.StringValue) error {
+			received = value
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.GetValue() != "hello" {
+		t.Errorf("received %q, want %q", received.GetValue(), "hello")
+	}
+}
+
+// scalarValue holds a field of every Avro primitive type supported by the
+// protobuf record codec
+type scalarValue struct {
+	Name    string  `avro:"name"`
+	Enabled bool    `avro:"enabled"`
+	Count   int32   `avro:"count"`
+	Total   int64   `avro:"total"`
+	Ratio   float32 `avro:"ratio"`
+	Price   float64 `avro:"price"`
+	Data    []byte  `avro:"data"`
+}
+
+func TestProtoRecordCodecPrimitives(t *testing.T) {
+	tests := []struct {
+		avroType string
+		field    string
+		value    scalarValue
+	}{
+		{"string", "name", scalarValue{Name: "book"}},
+		{"boolean", "enabled", scalarValue{Enabled: true}},
+		{"int", "count", scalarValue{Count: -42}},
+		{"long", "total", scalarValue{Total: 1 << 40}},
+		{"float", "ratio", scalarValue{Ratio: 0.5}},
+		{"double", "price", scalarValue{Price: 12.25}},
+		{"bytes", "data", scalarValue{Data: []byte{0, 1, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.avroType, func(t *testing.T) {
+			schema := `{"type":"record","name":"ScalarValue","namespace":"test","fields":[` +
+				`{"name":"` + tt.field + `","type":"` + tt.avroType + `"}]}`
+			codec, err := NewProtoRecordCodec[scalarValue](schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := codec.Encode(&tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var received scalarValue
+			if err := codec.Decode(data, &received); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(received, tt.value) {
+				t.Errorf("received %+v, want %+v", received, tt.value)
+			}
+		})
+	}
+}
+
+func TestProtoRecordCodecRejectsUnsupportedTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		fieldType string
+	}{
+		{"nullable union", `["null","string"]`},
+		{"array", `{"type":"array","items":"string"}`},
+		{"nested record", `{"type":"record","name":"Item","fields":[{"name":"name","type":"string"}]}`},
+		{"enum", `{"type":"enum","name":"Kind","symbols":["A","B"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := `{"type":"record","name":"Bad","fields":[{"name":"name","type":` + tt.fieldType + `}]}`
+			if _, err := NewProtoRecordCodec[scalarValue](schema); err == nil {
+				t.Errorf("NewProtoRecordCodec accepted a field of type %s", tt.fieldType)
+			}
+		})
+	}
+}
+
+func TestDecodeHandlerRecordsDecodeError(t *testing.T) {
+	tel, recorder := newTestTelemetry(t, sdktrace.AlwaysSample())
+	reader := recordMetrics(t, tel)
+	codec, err := NewJSONCodec[codecValue](codecValueSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	called := false
+	consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic")
+	_ = consumer.Process(context.Background(), payloadMessage{payload: []byte("not json")},
+		DecodeHandler(tel, codec, func(ctx context.Context, msg pulsar.Message, value *codecValue) error {
+			called = true
+			return nil
+		}))
+	if called {
+		t.Error("handler called with a payload that cannot be decoded")
+	}
+
+	span := processSpan(t, recorder)
+	if span.Status().Code != codes.Error {
+		t.Errorf("span status = %v, want %v", span.Status().Code, codes.Error)
+	}
+	codecErrors, _ := int64Value(t, reader, "pulsar.messages.codec_errors",
+		attribute.String("topic", "test-topic"),
+		attribute.String("operation", "decode"),
+		attribute.String("codec", CodecJSON))
+	if codecErrors != 1 {
+		t.Errorf("pulsar.messages.codec_errors = %d, want 1", codecErrors)
+	}
+}
+
+func TestTypedProducerContractModes(t *testing.T) {
+	for _, strict := range []bool{true, false} {
+		tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+		reader := recordMetrics(t, tel)
+		codec, err := NewJSONCodec[codecValue](codecValueSchema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contract, err := NewContract("CodecValue", codecValueJSONSchema, strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fake := &fakeProducer{}
+		producer := NewTypedProducer(tel.NewTracedProducer(fake), codec, WithContract(contract))
+		// The id must not be empty
+		_, err = producer.SendValue(context.Background(), &codecValue{Content: "hello"}, nil)
+
+		if strict {
+			if !errors.Is(err, ErrContractViolation) {
+				t.Errorf("strict send error = %v, want a contract violation", err)
+			}
+			if len(fake.messages) != 0 {
+				t.Error("strict mode sent a payload violating the contract")
+			}
+		} else {
+			if err != nil {
+				t.Errorf("warn send error = %v, want none", err)
+			}
+			if len(fake.messages) != 1 {
+				t.Error("warn mode did not send a payload violating the contract")
+			}
+		}
+		violations, _ := int64Value(t, reader, "messaging.contract.violations",
+			attribute.String("topic", "test-topic"),
+			attribute.String("operation", "publish"),
+			attribute.String("message", "CodecValue"),
+			attribute.Bool("strict", strict))
+		if violations != 1 {
+			t.Errorf("messaging.contract.violations with strict=%t = %d, want 1", strict, violations)
+		}
+	}
+}
+
+// ackConsumer is a retryConsumer counting the messages acked and nacked
+type ackConsumer struct {
+	retryConsumer
+
+	acked, nacked int
+}
+
+func (c *ackConsumer) Ack(pulsar.Message) error {
+	c.acked++
+	return nil
+}
+
+func (c *ackConsumer) Nack(pulsar.Message) {
+	c.nacked++
+}
+
+func TestDecodeHandlerContractViolation(t *testing.T) {
+	tests := []struct {
+		name   string
+		strict bool
+		retry  bool
+		// want* are the expected handler calls, acks, nacks and redeliveries
+		wantCalls, wantAcked, wantNacked, wantReconsumed int
+	}{
+		{name: "warn", wantCalls: 1, wantAcked: 1},
+		{name: "strict drops", strict: true, wantAcked: 1},
+		{name: "strict dead-letters", strict: true, retry: true, wantReconsumed: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tel, recorder := newTestTelemetry(t, sdktrace.AlwaysSample())
+			reader := recordMetrics(t, tel)
+			codec, err := NewJSONCodec[codecValue](codecValueSchema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contract, err := NewContract("CodecValue", codecValueJSONSchema, tt.strict)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fake := &ackConsumer{}
+			var opts []ConsumerOption
+			if tt.retry {
+				opts = append(opts, WithRetryPolicy(RetryPolicy{
+					MaxRetries:      3,
+					InitialBackoff:  time.Second,
+					RetryTopic:      "test-topic-RETRY",
+					DeadLetterTopic: "test-topic-DLQ",
+				}))
+			}
+			consumer := tel.NewTracedConsumer(fake, "test-topic", opts...)
+
+			calls := 0
+			// The id must not be empty
+			msg := payloadMessage{payload: []byte(`{"id":"","content":"hello"}`)}
+			err = consumer.Process(context.Background(), msg, DecodeHandler(tel, codec,
+				func(ctx context.Context, msg pulsar.Message, value *codecValue) error {
+					calls++
+					return nil
+				}, WithContract(contract)))
+
+			if tt.strict != errors.Is(err, ErrContractViolation) {
+				t.Errorf("Process() = %v, want a contract violation only in strict mode", err)
+			}
+			if calls != tt.wantCalls || fake.acked != tt.wantAcked || fake.nacked != tt.wantNacked ||
+				len(fake.calls) != tt.wantReconsumed {
+				t.Errorf("handler calls, acked, nacked, reconsumed = %d, %d, %d, %d, want %d, %d, %d, %d",
+					calls, fake.acked, fake.nacked, len(fake.calls),
+					tt.wantCalls, tt.wantAcked, tt.wantNacked, tt.wantReconsumed)
+			}
+			if tt.retry && len(fake.calls) == 1 {
+				// Pulsar dead-letters a message redelivered more than MaxRetries times
+				properties := fake.calls[0].properties
+				if got := properties[pulsar.SysPropertyReconsumeTimes]; got != "3" {
+					t.Errorf("%s = %q, want 3 so that Pulsar dead-letters the message",
+						pulsar.SysPropertyReconsumeTimes, got)
+				}
+				if got := properties[pulsar.SysPropertyRealTopic]; got != "test-topic" {
+					t.Errorf("%s = %q, want test-topic", pulsar.SysPropertyRealTopic, got)
+				}
+				var sendSpan sdktrace.ReadOnlySpan
+				for _, span := range recorder.Ended() {
+					if span.Name() == "send test-topic-DLQ" {
+						sendSpan = span
+					}
+				}
+				if sendSpan == nil {
+					t.Error("no send test-topic-DLQ span, want the message dead-lettered")
+				}
+			}
+
+			violations, _ := int64Value(t, reader, "messaging.contract.violations",
+				attribute.String("topic", "test-topic"),
+				attribute.String("operation", "process"),
+				attribute.String("message", "CodecValue"),
+				attribute.Bool("strict", tt.strict))
+			if violations != 1 {
+				t.Errorf("messaging.contract.violations = %d, want 1", violations)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package pulsarotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// receiveErrorBackoff is the pause after a failed Receive, so that a broken
+// connection does not turn the consume loop into a busy loop
+const receiveErrorBackoff = time.Second
+
+// abortGracePeriod bounds the time Shutdown waits for the cancelled handlers
+// to return once its context is done
+const abortGracePeriod = 2 * time.Second
+
+// Handler processes a single message. The context carries the process span,
+// which is a child of the producer span extracted from the message
+// properties, or linked to it with PropagationLink. Returning an error nacks
+// the message, or hands it to the retry policy when one is configured. An
+// error wrapping ErrContractViolation is permanent: the message is
+// dead-lettered at once with a retry policy, and acknowledged and dropped
+// without one.
+type Handler func(ctx context.Context, msg pulsar.Message) error
+
+// TracedConsumer wraps a pulsar.Consumer and runs a Handler for every
+// received message inside a process span, acknowledging the message when the
+// handler succeeds and negatively acknowledging it when it fails
+type TracedConsumer struct {
+	pulsar.Consumer
+
+	tel         *Telemetry
+	topic       string
+	retry       *RetryPolicy
+	propagation PropagationMode
+	baggageKeys []string
+
+	workers     int
+	maxInFlight int
+	keyOrdering bool
+
+	// stopping is cancelled by Shutdown to stop Run from receiving
+	stopping      context.Context
+	stopReceiving context.CancelFunc
+
+	// mu guards the worker pool started by Run and whether Shutdown was
+	// called, so that a Run starting after Shutdown never receives
+	mu      sync.Mutex
+	pool    *workerPool
+	stopped bool
+}
+
+var _ pulsar.Consumer = (*TracedConsumer)(nil)
+
+// ConsumerOption configures a TracedConsumer
+type ConsumerOption func(*TracedConsumer)
+
+// WithRetryPolicy redelivers failed messages through the retry letter topic
+// and dead-letters them once the retries are exhausted, instead of nacking
+// them. Subscribe enables the Pulsar retry and DLQ support accordingly; a
+// consumer passed to NewTracedConsumer must have been created with
+// RetryEnable and a matching DLQ policy.
+func WithRetryPolicy(policy RetryPolicy) ConsumerOption {
+	return func(c *TracedConsumer) {
+		c.retry = &policy
+	}
+}
+
+func (t *Telemetry) newTracedConsumer(topic string, opts []ConsumerOption) *TracedConsumer {
+	c := &TracedConsumer{
+		tel:         t,
+		topic:       topic,
+		propagation: PropagationParent,
+	}
+	c.stopping, c.stopReceiving = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewTracedConsumer wraps an existing consumer subscribed to topic with
+// tracing and metrics
+func (t *Telemetry) NewTracedConsumer(consumer pulsar.Consumer, topic string, opts ...ConsumerOption) *TracedConsumer {
+	c := t.newTracedConsumer(topic, opts)
+	c.Consumer = consumer
+	return c
+}
+
+// Subscribe creates a Pulsar consumer inside a create_consumer span and
+// wraps it in a TracedConsumer
+func (t *Telemetry) Subscribe(ctx context.Context, client pulsar.Client, opts pulsar.ConsumerOptions, copts ...ConsumerOption) (*TracedConsumer, error) {
+	c := t.newTracedConsumer(opts.Topic, copts)
+	if c.retry != nil {
+		opts.RetryEnable = true
+		opts.DLQ = c.retry.dlqPolicy()
+	}
+
+	// Use messaging semantic conventions
+	ctx, span := t.tracer.Start(ctx, fmt.Sprintf("%s create_consumer", opts.Topic),
+		trace.WithAttributes(
+			semconv.MessagingSystemPulsar,
+			semconv.MessagingDestinationName(opts.Topic),
+			semconv.MessagingDestinationSubscriptionName(opts.SubscriptionName),
+		),
+	)
+	defer span.End()
+
+	t.logger.Info("Creating Pulsar consumer",
+		zap.String("topic", opts.Topic),
+		zap.String("subscription", opts.SubscriptionName),
+		ContextField(ctx))
+
+	consumer, err := client.Subscribe(opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	c.Consumer = consumer
+
+	if c.retry != nil {
+		// Pulsar resolved the default retry and dead letter topic names
+		c.retry.RetryTopic = opts.DLQ.RetryLetterTopic
+		c.retry.DeadLetterTopic = opts.DLQ.DeadLetterTopic
+		t.logger.Info("Retry and dead letter topics enabled",
+			zap.String("retry_topic", c.retry.RetryTopic),
+			zap.String("dead_letter_topic", c.retry.DeadLetterTopic),
+			zap.Uint32("max_retries", c.retry.MaxRetries),
+			ContextField(ctx))
+	}
+
+	return c, nil
+}
+
+// Run receives messages and passes each one to Process on the worker pool
+// until ctx is done or Shutdown is called, then waits for the messages
+// already received to be processed. Handlers are not cancelled with ctx, only
+// when Shutdown gives up waiting for them. Run returns immediately when
+// Shutdown was called first, and fails when the consumer already runs.
+func (c *TracedConsumer) Run(ctx context.Context, handler Handler) error {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return nil
+	}
+	if c.pool != nil {
+		c.mu.Unlock()
+		return errors.New("consumer is already running")
+	}
+	pool := c.newWorkerPool(ctx, handler)
+	c.pool = pool
+	c.mu.Unlock()
+	defer pool.close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(c.stopping, cancel)
+	defer stop()
+
+	c.tel.logger.Info("Starting consumer",
+		zap.String("topic", c.topic),
+		zap.String("subscription", c.Subscription()),
+		zap.Int("workers", pool.workers),
+		zap.Int("max_in_flight", cap(pool.slots)),
+		zap.Bool("key_ordering", c.keyOrdering))
+
+	for pool.acquire(ctx) {
+		msg, err := c.Receive(ctx)
+		if err != nil {
+			pool.release()
+			if ctx.Err() != nil {
+				return nil
+			}
+			c.tel.logger.Error("Error receiving message", zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(receiveErrorBackoff):
+			}
+			continue
+		}
+
+		pool.dispatch(ctx, msg)
+	}
+	return nil
+}
+
+// Shutdown stops Run from receiving messages and waits until the messages
+// already received have been processed and acknowledged, or until ctx is
+// done. In that case the running handlers are cancelled, the queued messages
+// are left unacknowledged for Pulsar to redeliver, and Shutdown waits a grace
+// period of 2 seconds for the handlers to return. The number of messages left
+// unacknowledged is returned along with the context error, counting the
+// handlers still running after the grace period. Shutdown called before Run
+// returns at once and prevents Run from starting.
+//
+// Shutdown does not close the underlying consumer. Call Close only once
+// Shutdown has returned, so that no handler acks on a closed consumer.
+func (c *TracedConsumer) Shutdown(ctx context.Context) (dropped int, err error) {
+	c.mu.Lock()
+	c.stopped = true
+	pool := c.pool
+	c.mu.Unlock()
+	c.stopReceiving()
+	if pool == nil {
+		// Run has not started and will not receive any message
+		return 0, nil
+	}
+
+	select {
+	case <-pool.done:
+		return 0, nil
+	case <-ctx.Done():
+		dropped, stopped := pool.abort(abortGracePeriod)
+		c.tel.logger.Warn("Consumer drain timed out",
+			zap.String("topic", c.topic),
+			zap.String("subscription", c.Subscription()),
+			zap.Int("dropped", dropped),
+			zap.Bool("handlers_stopped", stopped))
+		return dropped, ctx.Err()
+	}
+}
+
+// CheckProgress returns an error when Run holds in-flight messages but none
+// has been received or processed for longer than threshold, which means the
+// handlers are stuck. An idle consumer waiting for messages is not stalled.
+func (c *TracedConsumer) CheckProgress(threshold time.Duration) error {
+	c.mu.Lock()
+	pool := c.pool
+	c.mu.Unlock()
+	if pool == nil {
+		return nil
+	}
+	return pool.stalled(threshold)
+}
+
+// Process runs handler for msg inside a process span, then acks the message
+// on success, and on error nacks it or hands it to the retry policy, unless
+// the error is permanent as described in Handler. The
+// consume metrics are recorded, counting a failed ack as a failure, and the
+// handler error is returned.
+func (c *TracedConsumer) Process(ctx context.Context, msg pulsar.Message, handler Handler) error {
+	startTime := time.Now()
+	subscription := c.Subscription()
+
+	properties := msg.Properties()
+
+	// Extract trace context from message properties
+	msgCtx := ExtractTraceContext(ctx, properties)
+	producerSpanContext := trace.SpanContextFromContext(msgCtx)
+	baggageAttrs := c.baggageAttributes(msgCtx)
+
+	// Span name and kind follow the messaging semantic conventions
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemPulsar,
+		semconv.MessagingOperationTypeProcess,
+		semconv.MessagingOperationName(operationProcess),
+		semconv.MessagingDestinationName(c.topic),
+		semconv.MessagingDestinationSubscriptionName(subscription),
+		semconv.MessagingClientID(c.Name()),
+		semconv.MessagingMessageBodySize(len(msg.Payload())),
+		attribute.String("pulsar.message_id", msg.ID().String()),
+	}
+	// A message published without an id has none to report
+	if id, ok := properties["message_id"]; ok {
+		attrs = append(attrs, semconv.MessagingMessageID(id))
+	}
+	attrs = append(attrs, c.tel.legacySpanAttributes(operationProcess, subscription)...)
+	startOpts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(append(attrs, c.tel.serverAttrs...)...),
+		trace.WithAttributes(baggageAttrs...),
+	}
+	if c.propagation == PropagationLink {
+		// Start a new trace linked to the producer span, keeping the
+		// extracted baggage in the context
+		startOpts = append(startOpts, trace.WithNewRoot())
+		if producerSpanContext.IsValid() {
+			startOpts = append(startOpts, trace.WithLinks(trace.Link{SpanContext: producerSpanContext}))
+		}
+	}
+	msgCtx, span := c.tel.tracer.Start(msgCtx, c.tel.spanName(operationProcess, c.topic), startOpts...)
+	defer span.End()
+	msgCtx = contextWithLogFields(msgCtx, logFields(baggageAttrs))
+
+	var ackErr error
+	err := c.runHandler(msgCtx, msg, handler)
+	if err != nil {
+		c.tel.logger.Error("Failed to process message",
+			zap.Error(err),
+			zap.String("messageID", msg.ID().String()),
+			ContextField(msgCtx))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to process message")
+
+		// A payload breaking its contract fails again on every redelivery
+		permanent := errors.Is(err, ErrContractViolation)
+		switch {
+		case permanent && c.retry == nil:
+			if ackErr = c.Ack(msg); ackErr != nil {
+				c.tel.logger.Error("Failed to acknowledge message", zap.Error(ackErr))
+				span.RecordError(ackErr)
+			} else {
+				c.tel.logger.Warn("Message dropped",
+					zap.String("messageID", msg.ID().String()),
+					ContextField(msgCtx))
+				span.AddEvent("message dropped")
+			}
+		case c.retry == nil:
+			c.Nack(msg)
+			span.AddEvent("message nacked")
+		case c.retryOrDeadLetter(msgCtx, msg, producerSpanContext, permanent):
+			span.AddEvent("message dead-lettered")
+		default:
+			span.AddEvent("message scheduled for retry")
+		}
+	} else if ackErr = c.Ack(msg); ackErr != nil {
+		c.tel.logger.Error("Failed to acknowledge message", zap.Error(ackErr))
+		span.RecordError(ackErr)
+		span.SetStatus(codes.Error, "Failed to acknowledge message")
+	} else {
+		span.SetStatus(codes.Ok, "")
+		span.AddEvent("message acknowledged")
+	}
+
+	// Record metrics
+	duration := time.Since(startTime)
+	c.tel.RecordConsume(ctx, duration, c.topic, subscription, err == nil && ackErr == nil, baggageAttrs...)
+	latency, source := endToEndLatency(msg, time.Now())
+	c.tel.RecordEndToEnd(ctx, latency, c.topic, subscription, source, baggageAttrs...)
+
+	return err
+}
+
+// endToEndLatency returns the time elapsed between the event time of msg, or
+// its publish time when the producer set no event time, and now, together
+// with the name of the timestamp used. Clock skew between the producer or
+// broker and the consumer never yields a negative latency.
+func endToEndLatency(msg pulsar.Message, now time.Time) (time.Duration, string) {
+	start, source := msg.PublishTime(), "publish_time"
+	// Pulsar reports an unset event time as the Unix epoch
+	if eventTime := msg.EventTime(); eventTime.UnixMilli() > 0 {
+		start, source = eventTime, "event_time"
+	}
+	return max(now.Sub(start), 0), source
+}
+
+// runHandler calls handler and turns a panic into an error so that the
+// message is nacked instead of crashing the consume loop
+func (c *TracedConsumer) runHandler(ctx context.Context, msg pulsar.Message, handler Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, msg)
+}
@@ -0,0 +1,428 @@
+package pulsarotel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// failingAckConsumer is a fakeConsumer whose acks fail
+type failingAckConsumer struct {
+	fakeConsumer
+}
+
+func (failingAckConsumer) Ack(pulsar.Message) error { return errors.New("connection closed") }
+
+// shutdownResult is the outcome of a TracedConsumer.Shutdown call
+type shutdownResult struct {
+	dropped int
+	err     error
+}
+
+// shutdownAsync calls Shutdown with a context expiring after timeout and
+// delivers its result on the returned channel
+func shutdownAsync(consumer *TracedConsumer, timeout time.Duration) <-chan shutdownResult {
+	result := make(chan shutdownResult, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		dropped, err := consumer.Shutdown(ctx)
+		result <- shutdownResult{dropped, err}
+	}()
+	return result
+}
+
+func TestShutdownDrainsInFlightMessages(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	fake := newQueueConsumer()
+	consumer := tel.NewTracedConsumer(fake, "test-topic", WithWorkers(2), WithMaxInFlight(3))
+
+	release := make(chan struct{})
+	runConsumer(t, consumer, func(ctx context.Context, msg pulsar.Message) error {
+		<-release
+		return nil
+	})
+	for seq := range 3 {
+		fake.messages <- keyedMessage{seq: seq}
+	}
+	waitFor(t, "the messages to be received", func() bool { return fake.received.Load() == 3 })
+
+	result := shutdownAsync(consumer, 5*time.Second)
+	select {
+	case r := <-result:
+		t.Fatalf("Shutdown returned %+v before the handlers finished", r)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	r := <-result
+	if r.dropped != 0 || r.err != nil {
+		t.Errorf("Shutdown() = %d, %v, want 0, nil", r.dropped, r.err)
+	}
+	if got := fake.acked.Load(); got != 3 {
+		t.Errorf("%d messages acknowledged, want the 3 in flight", got)
+	}
+}
+
+func TestShutdownDeadlineCancelsHandlers(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	fake := newQueueConsumer()
+	consumer := tel.NewTracedConsumer(fake, "test-topic")
+
+	cancelled := make(chan error, 1)
+	runConsumer(t, consumer, func(ctx context.Context, msg pulsar.Message) error {
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return ctx.Err()
+	})
+	fake.messages <- keyedMessage{}
+	waitFor(t, "the message to be received", func() bool { return fake.received.Load() == 1 })
+
+	r := <-shutdownAsync(consumer, 20*time.Millisecond)
+	if !errors.Is(r.err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want %v", r.err, context.DeadlineExceeded)
+	}
+	select {
+	case err := <-cancelled:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("handler context error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler context not cancelled after the shutdown deadline")
+	}
+	if got := fake.acked.Load(); got != 0 {
+		t.Errorf("%d messages acknowledged, want none", got)
+	}
+}
+
+func TestShutdownReportsDroppedMessages(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	fake := newQueueConsumer()
+	consumer := tel.NewTracedConsumer(fake, "test-topic", WithWorkers(1), WithMaxInFlight(3))
+
+	var handled atomic.Int64
+	runConsumer(t, consumer, func(ctx context.Context, msg pulsar.Message) error {
+		handled.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	// One message is processed while the two others wait in the queue
+	for seq := range 3 {
+		fake.messages <- keyedMessage{seq: seq}
+	}
+	waitFor(t, "the messages to be received", func() bool { return fake.received.Load() == 3 })
+
+	r := <-shutdownAsync(consumer, 20*time.Millisecond)
+	if r.dropped != 3 {
+		t.Errorf("Shutdown() dropped = %d, want the 3 messages in flight", r.dropped)
+	}
+	if got := handled.Load(); got != 1 {
+		t.Errorf("handler called %d times, want the queued messages skipped", got)
+	}
+	if got := fake.acked.Load(); got != 0 {
+		t.Errorf("%d messages acknowledged, want none", got)
+	}
+}
+
+func TestShutdownWaitsForCancelledHandlers(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	fake := newQueueConsumer()
+	consumer := tel.NewTracedConsumer(fake, "test-topic", WithWorkers(1), WithMaxInFlight(2))
+
+	runConsumer(t, consumer, func(ctx context.Context, msg pulsar.Message) error {
+		// The handler finishes its work after the cancellation
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	for seq := range 2 {
+		fake.messages <- keyedMessage{seq: seq}
+	}
+	waitFor(t, "the messages to be received", func() bool { return fake.received.Load() == 2 })
+
+	r := <-shutdownAsync(consumer, 20*time.Millisecond)
+	if got := fake.acked.Load(); got != 1 {
+		t.Errorf("%d messages acknowledged when Shutdown returned, want the one being processed", got)
+	}
+	if r.dropped != 1 {
+		t.Errorf("Shutdown() dropped = %d, want only the queued message", r.dropped)
+	}
+}
+
+func TestShutdownBeforeRun(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	fake := newQueueConsumer()
+	consumer := tel.NewTracedConsumer(fake, "test-topic")
+	fake.messages <- keyedMessage{}
+
+	dropped, err := consumer.Shutdown(context.Background())
+	if dropped != 0 || err != nil {
+		t.Errorf("Shutdown() = %d, %v, want 0, nil", dropped, err)
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- consumer.Run(context.Background(), func(ctx context.Context, msg pulsar.Message) error {
+			t.Error("handler called after Shutdown")
+			return nil
+		})
+	}()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("Run() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Shutdown")
+	}
+	if got := fake.received.Load(); got != 0 {
+		t.Errorf("%d messages received after Shutdown, want none", got)
+	}
+}
+
+func TestShutdownRacingRun(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	for range 50 {
+		fake := newQueueConsumer()
+		consumer := tel.NewTracedConsumer(fake, "test-topic")
+		fake.messages <- keyedMessage{}
+
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			_ = consumer.Run(context.Background(), func(ctx context.Context, msg pulsar.Message) error {
+				return nil
+			})
+		}()
+		dropped, err := consumer.Shutdown(context.Background())
+		if dropped != 0 || err != nil {
+			t.Fatalf("Shutdown() = %d, %v, want 0, nil", dropped, err)
+		}
+		// Whether Run started first or not, Shutdown returns only once every
+		// message received was processed
+		if got, want := fake.acked.Load(), fake.received.Load(); got != want {
+			t.Fatalf("%d of %d received messages acknowledged when Shutdown returned", got, want)
+		}
+		<-stopped
+	}
+}
+
+func TestProcessSpanFollowsMetricNames(t *testing.T) {
+	tests := []struct {
+		names    MetricNames
+		spanName string
+		legacy   bool
+	}{
+		{MetricNamesSemconv, "process test-topic", false},
+		{MetricNamesLegacy, "test-topic process", true},
+		{MetricNamesBoth, "process test-topic", true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.names), func(t *testing.T) {
+			tel, recorder := newTestTelemetry(t, sdktrace.AlwaysSample())
+			tel.metricNames = tt.names
+			consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic")
+			msg := fakeMessage{properties: map[string]string{"message_id": "msg-1"}}
+			if err := consumer.Process(context.Background(), msg, func(ctx context.Context, msg pulsar.Message) error {
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("recorded %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.spanName {
+				t.Errorf("span name = %q, want %q", span.Name(), tt.spanName)
+			}
+			attrs := make(map[attribute.Key]string)
+			for _, attr := range span.Attributes() {
+				attrs[attr.Key] = attr.Value.Emit()
+			}
+			if got := attrs["messaging.operation.type"]; got != "process" {
+				t.Errorf("messaging.operation.type = %q, want process", got)
+			}
+			if got := attrs["messaging.message.id"]; got != "msg-1" {
+				t.Errorf("messaging.message.id = %q, want msg-1", got)
+			}
+			wantOperation, wantSubscription := "", ""
+			if tt.legacy {
+				wantOperation, wantSubscription = "process", "test-subscription"
+			}
+			if got := attrs["messaging.operation"]; got != wantOperation {
+				t.Errorf("messaging.operation = %q, want %q", got, wantOperation)
+			}
+			if got := attrs["pulsar.subscription"]; got != wantSubscription {
+				t.Errorf("pulsar.subscription = %q, want %q", got, wantSubscription)
+			}
+		})
+	}
+}
+
+func TestProcessSpanOmitsUnknownMessageID(t *testing.T) {
+	tel, recorder := newTestTelemetry(t, sdktrace.AlwaysSample())
+	consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic")
+	if err := consumer.Process(context.Background(), fakeMessage{}, func(ctx context.Context, msg pulsar.Message) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, attr := range processSpan(t, recorder).Attributes() {
+		if attr.Key == "messaging.message.id" {
+			t.Errorf("messaging.message.id = %q, want no attribute without a message id", attr.Value.Emit())
+		}
+	}
+}
+
+func TestProcessRecordsFailedAck(t *testing.T) {
+	tel, recorder := newTestTelemetry(t, sdktrace.AlwaysSample())
+	reader := recordMetrics(t, tel)
+	consumer := tel.NewTracedConsumer(failingAckConsumer{}, "test-topic")
+
+	err := consumer.Process(context.Background(), fakeMessage{},
+		func(ctx context.Context, msg pulsar.Message) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := processSpan(t, recorder).Status(); status.Code != codes.Error {
+		t.Errorf("span status = %v, want %v", status.Code, codes.Error)
+	}
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "messaging.process.duration" {
+				continue
+			}
+			for _, point := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+				if !point.Attributes.HasValue("error.type") {
+					t.Errorf("messaging.process.duration recorded without error.type, want the failed ack counted as a failure")
+				}
+			}
+			return
+		}
+	}
+	t.Error("messaging.process.duration not recorded")
+}
+
+// timedMessage is a fakeMessage with the given event and publish times
+type timedMessage struct {
+	fakeMessage
+	eventTime   time.Time
+	publishTime time.Time
+}
+
+func (m timedMessage) EventTime() time.Time   { return m.eventTime }
+func (m timedMessage) PublishTime() time.Time { return m.publishTime }
+
+func TestEndToEndLatency(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		eventTime   time.Time
+		publishTime time.Time
+		wantLatency time.Duration
+		wantSource  string
+	}{
+		{
+			name:        "event time",
+			eventTime:   now.Add(-3 * time.Second),
+			publishTime: now.Add(-time.Second),
+			wantLatency: 3 * time.Second,
+			wantSource:  "event_time",
+		},
+		{
+			name:        "unset event time",
+			eventTime:   time.Unix(0, 0),
+			publishTime: now.Add(-time.Second),
+			wantLatency: time.Second,
+			wantSource:  "publish_time",
+		},
+		{
+			name:        "zero event time",
+			publishTime: now.Add(-2 * time.Second),
+			wantLatency: 2 * time.Second,
+			wantSource:  "publish_time",
+		},
+		{
+			name:        "event time ahead of the consumer clock",
+			eventTime:   now.Add(time.Second),
+			publishTime: now.Add(-time.Second),
+			wantLatency: 0,
+			wantSource:  "event_time",
+		},
+		{
+			name:        "publish time ahead of the consumer clock",
+			eventTime:   time.Unix(0, 0),
+			publishTime: now.Add(time.Second),
+			wantLatency: 0,
+			wantSource:  "publish_time",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := timedMessage{eventTime: tt.eventTime, publishTime: tt.publishTime}
+			latency, source := endToEndLatency(msg, now)
+			if latency != tt.wantLatency || source != tt.wantSource {
+				t.Errorf("endToEndLatency() = %v, %q, want %v, %q", latency, source, tt.wantLatency, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestProcessRecordsLatencyTimeSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		eventTime  time.Time
+		wantSource string
+	}{
+		{"event time", time.Now().Add(-time.Second), "event_time"},
+		{"unset event time", time.Unix(0, 0), "publish_time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+			reader := recordMetrics(t, tel)
+			consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic")
+			msg := timedMessage{eventTime: tt.eventTime, publishTime: time.Now()}
+			if err := consumer.Process(context.Background(), msg, func(ctx context.Context, msg pulsar.Message) error {
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(context.Background(), &rm); err != nil {
+				t.Fatal(err)
+			}
+			var sources []string
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					if m.Name != "pulsar.message.e2e.latency" {
+						continue
+					}
+					for _, point := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+						source, _ := point.Attributes.Value("time_source")
+						sources = append(sources, source.AsString())
+					}
+				}
+			}
+			if len(sources) != 1 || sources[0] != tt.wantSource {
+				t.Errorf("pulsar.message.e2e.latency time_source = %v, want [%s]", sources, tt.wantSource)
+			}
+		})
+	}
+}
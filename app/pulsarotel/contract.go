@@ -0,0 +1,122 @@
+package pulsarotel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// ErrContractViolation is wrapped by the errors returned for payloads that
+// do not match their contract in strict mode
+var ErrContractViolation = errors.New("contract violation")
+
+// Contract validates the payloads of a message against the JSON Schema
+// declared for it in the AsyncAPI spec. A violation is recorded as a span
+// event and counted in messaging.contract.violations. In strict mode it also
+// fails the send, or the processing of a received message, which is then
+// dead-lettered or dropped rather than redelivered.
+type Contract struct {
+	message string
+	schema  *jsonschema.Schema
+	strict  bool
+}
+
+// NewContract compiles the JSON Schema of message. AsyncAPI payload schemas
+// are a superset of JSON Schema draft 7, which is assumed when the schema
+// does not declare $schema.
+func NewContract(message, jsonSchema string, strict bool) (*Contract, error) {
+	doc, err := jsonschema.UnmarshalJSON(strings.NewReader(jsonSchema))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema of %s: %w", message, err)
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft7)
+	location := "contract:///" + message + ".json"
+	if err := compiler.AddResource(location, doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema of %s: %w", message, err)
+	}
+	schema, err := compiler.Compile(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema of %s: %w", message, err)
+	}
+	return &Contract{message: message, schema: schema, strict: strict}, nil
+}
+
+// Message returns the name of the message the contract applies to
+func (c *Contract) Message() string {
+	return c.message
+}
+
+// Strict reports whether violations fail the send or the processing
+func (c *Contract) Strict() bool {
+	return c.strict
+}
+
+// Validate checks the JSON document data against the schema
+func (c *Contract) Validate(data []byte) error {
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("payload is not valid JSON: %w", err)
+	}
+	err = c.schema.Validate(instance)
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		return errors.New(describeViolations(validationErr))
+	}
+	return err
+}
+
+// describeViolations lists the failed constraints on a single line, as in
+// /message_id: minLength: got 0, want 1
+func describeViolations(err *jsonschema.ValidationError) string {
+	var violations []string
+	for _, unit := range err.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		location := unit.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		violations = append(violations, location+": "+unit.Error.String())
+	}
+	if len(violations) == 0 {
+		return err.Error()
+	}
+	return strings.Join(violations, "; ")
+}
+
+// check validates data inside the span of ctx and records a violation. The
+// violation is returned only in strict mode.
+func (c *Contract) check(ctx context.Context, t *Telemetry, topic string, operation string, data []byte) error {
+	err := c.Validate(data)
+	if err == nil {
+		return nil
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("messaging.contract.violation", trace.WithAttributes(
+		attribute.String("messaging.contract.message", c.message),
+		attribute.String("messaging.contract.error", err.Error()),
+		attribute.Bool("messaging.contract.strict", c.strict),
+	))
+	t.RecordContractViolation(ctx, topic, operation, c.message, c.strict)
+	t.logger.Warn("Payload violates its contract",
+		zap.String("message", c.message),
+		zap.String("topic", topic),
+		zap.String("operation", operation),
+		zap.Bool("strict", c.strict),
+		zap.Error(err),
+		ContextField(ctx))
+
+	if c.strict {
+		return fmt.Errorf("%w: %s payload: %w", ErrContractViolation, c.message, err)
+	}
+	return nil
+}
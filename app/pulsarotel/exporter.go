@@ -0,0 +1,198 @@
+package pulsarotel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	collogpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Protocol is the OTLP transport, using the values of OTEL_EXPORTER_OTLP_PROTOCOL
+type Protocol string
+
+const (
+	// ProtocolGRPC exports OTLP over gRPC, usually on port 4317
+	ProtocolGRPC Protocol = "grpc"
+	// ProtocolHTTPProtobuf exports OTLP as protobuf over HTTP, usually on port 4318
+	ProtocolHTTPProtobuf Protocol = "http/protobuf"
+	// ProtocolHTTPJSON exports OTLP as JSON over HTTP, usually on port 4318
+	ProtocolHTTPJSON Protocol = "http/json"
+)
+
+// Default paths appended to a base HTTP endpoint, as defined by the OTLP exporter specification
+const (
+	tracesPath  = "/v1/traces"
+	metricsPath = "/v1/metrics"
+	logsPath    = "/v1/logs"
+)
+
+// signalExporter holds the resolved OTLP settings of a single signal
+type signalExporter struct {
+	protocol Protocol
+	// endpoint is either host:port or a full URL
+	endpoint string
+}
+
+// isURL reports whether the endpoint carries a scheme
+func (s signalExporter) isURL() bool {
+	return strings.Contains(s.endpoint, "://")
+}
+
+// isHTTP reports whether the signal is exported over HTTP
+func (s signalExporter) isHTTP() bool {
+	return s.protocol == ProtocolHTTPProtobuf || s.protocol == ProtocolHTTPJSON
+}
+
+// resolveSignal applies the per-signal overrides on top of the base OTLP
+// settings. A per-signal endpoint is used as is while a base HTTP URL gets
+// the signal path appended, following the OTLP exporter specification.
+func (o *options) resolveSignal(endpoint string, protocol Protocol, path string) signalExporter {
+	s := signalExporter{protocol: o.otlpProtocol, endpoint: endpoint}
+	if protocol != "" {
+		s.protocol = protocol
+	}
+	if s.endpoint == "" && o.otlpEndpoint != "" {
+		s.endpoint = o.otlpEndpoint
+		if s.isHTTP() && s.isURL() {
+			s.endpoint = strings.TrimSuffix(s.endpoint, "/") + path
+		}
+	}
+	return s
+}
+
+// newOTLPSpanExporter creates the OTLP span exporter for the configured protocol
+func newOTLPSpanExporter(ctx context.Context, s signalExporter, o *options) (sdktrace.SpanExporter, error) {
+	switch s.protocol {
+	case ProtocolHTTPProtobuf, ProtocolHTTPJSON:
+		opts := []otlptracehttp.Option{}
+		if s.isURL() {
+			opts = append(opts, otlptracehttp.WithEndpointURL(s.endpoint))
+		} else {
+			opts = append(opts, otlptracehttp.WithEndpoint(s.endpoint))
+		}
+		if o.otlpInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(o.otlpHeaders) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(o.otlpHeaders))
+		}
+		if s.protocol == ProtocolHTTPJSON {
+			opts = append(opts, otlptracehttp.WithHTTPClient(newJSONClient(
+				func() proto.Message { return &coltracepb.ExportTraceServiceRequest{} },
+				func() proto.Message { return &coltracepb.ExportTraceServiceResponse{} })))
+		}
+		return otlptrace.New(ctx, otlptracehttp.NewClient(opts...))
+	case ProtocolGRPC:
+		opts := []otlptracegrpc.Option{}
+		if s.isURL() {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(s.endpoint))
+		} else {
+			opts = append(opts, otlptracegrpc.WithEndpoint(s.endpoint))
+		}
+		if o.otlpInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if len(o.otlpHeaders) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(o.otlpHeaders))
+		}
+		return otlptrace.New(ctx, otlptracegrpc.NewClient(opts...))
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", s.protocol)
+	}
+}
+
+// newOTLPMetricExporter creates the OTLP metric exporter for the configured protocol
+func newOTLPMetricExporter(ctx context.Context, s signalExporter, o *options) (sdkmetric.Exporter, error) {
+	switch s.protocol {
+	case ProtocolHTTPProtobuf, ProtocolHTTPJSON:
+		opts := []otlpmetrichttp.Option{}
+		if s.isURL() {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(s.endpoint))
+		} else {
+			opts = append(opts, otlpmetrichttp.WithEndpoint(s.endpoint))
+		}
+		if o.otlpInsecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		if len(o.otlpHeaders) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(o.otlpHeaders))
+		}
+		if s.protocol == ProtocolHTTPJSON {
+			opts = append(opts, otlpmetrichttp.WithHTTPClient(newJSONClient(
+				func() proto.Message { return &colmetricpb.ExportMetricsServiceRequest{} },
+				func() proto.Message { return &colmetricpb.ExportMetricsServiceResponse{} })))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	case ProtocolGRPC:
+		opts := []otlpmetricgrpc.Option{}
+		if s.isURL() {
+			opts = append(opts, otlpmetricgrpc.WithEndpointURL(s.endpoint))
+		} else {
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(s.endpoint))
+		}
+		if o.otlpInsecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		if len(o.otlpHeaders) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(o.otlpHeaders))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", s.protocol)
+	}
+}
+
+// newOTLPLogExporter creates the OTLP log exporter for the configured protocol
+func newOTLPLogExporter(ctx context.Context, s signalExporter, o *options) (sdklog.Exporter, error) {
+	switch s.protocol {
+	case ProtocolHTTPProtobuf, ProtocolHTTPJSON:
+		opts := []otlploghttp.Option{}
+		if s.isURL() {
+			opts = append(opts, otlploghttp.WithEndpointURL(s.endpoint))
+		} else {
+			opts = append(opts, otlploghttp.WithEndpoint(s.endpoint))
+		}
+		if o.otlpInsecure {
+			opts = append(opts, otlploghttp.WithInsecure())
+		}
+		if len(o.otlpHeaders) > 0 {
+			opts = append(opts, otlploghttp.WithHeaders(o.otlpHeaders))
+		}
+		if s.protocol == ProtocolHTTPJSON {
+			opts = append(opts, otlploghttp.WithHTTPClient(newJSONClient(
+				func() proto.Message { return &collogpb.ExportLogsServiceRequest{} },
+				func() proto.Message { return &collogpb.ExportLogsServiceResponse{} })))
+		}
+		return otlploghttp.New(ctx, opts...)
+	case ProtocolGRPC:
+		opts := []otlploggrpc.Option{}
+		if s.isURL() {
+			opts = append(opts, otlploggrpc.WithEndpointURL(s.endpoint))
+		} else {
+			opts = append(opts, otlploggrpc.WithEndpoint(s.endpoint))
+		}
+		if o.otlpInsecure {
+			opts = append(opts, otlploggrpc.WithInsecure())
+		}
+		if len(o.otlpHeaders) > 0 {
+			opts = append(opts, otlploggrpc.WithHeaders(o.otlpHeaders))
+		}
+		return otlploggrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", s.protocol)
+	}
+}
@@ -0,0 +1,128 @@
+package pulsarotel
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestResolveSignal(t *testing.T) {
+	tests := []struct {
+		name         string
+		base         Protocol
+		baseEndpoint string
+		endpoint     string
+		protocol     Protocol
+		wantProtocol Protocol
+		wantEndpoint string
+	}{
+		{
+			name:         "host and port",
+			base:         ProtocolHTTPProtobuf,
+			baseEndpoint: "collector:4318",
+			wantProtocol: ProtocolHTTPProtobuf,
+			wantEndpoint: "collector:4318",
+		},
+		{
+			name:         "base URL gets the signal path",
+			base:         ProtocolHTTPProtobuf,
+			baseEndpoint: "http://collector:4318/",
+			wantProtocol: ProtocolHTTPProtobuf,
+			wantEndpoint: "http://collector:4318/v1/traces",
+		},
+		{
+			name:         "base URL over http/json",
+			base:         ProtocolHTTPJSON,
+			baseEndpoint: "http://collector:4318",
+			wantProtocol: ProtocolHTTPJSON,
+			wantEndpoint: "http://collector:4318/v1/traces",
+		},
+		{
+			name:         "base URL over grpc",
+			base:         ProtocolGRPC,
+			baseEndpoint: "http://collector:4317",
+			wantProtocol: ProtocolGRPC,
+			wantEndpoint: "http://collector:4317",
+		},
+		{
+			name:         "per-signal URL kept as is",
+			base:         ProtocolHTTPProtobuf,
+			baseEndpoint: "http://collector:4318",
+			endpoint:     "http://traces:4318/custom",
+			wantProtocol: ProtocolHTTPProtobuf,
+			wantEndpoint: "http://traces:4318/custom",
+		},
+		{
+			name:         "per-signal protocol override",
+			base:         ProtocolGRPC,
+			baseEndpoint: "http://collector:4318",
+			protocol:     ProtocolHTTPProtobuf,
+			wantProtocol: ProtocolHTTPProtobuf,
+			wantEndpoint: "http://collector:4318/v1/traces",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOptions([]Option{WithProtocol(tt.base), WithOTLPEndpoint(tt.baseEndpoint)})
+			got := o.resolveSignal(tt.endpoint, tt.protocol, tracesPath)
+			if got.protocol != tt.wantProtocol || got.endpoint != tt.wantEndpoint {
+				t.Errorf("resolveSignal() = %s %q, want %s %q",
+					got.protocol, got.endpoint, tt.wantProtocol, tt.wantEndpoint)
+			}
+		})
+	}
+}
+
+func TestHTTPJSONSpanExporter(t *testing.T) {
+	var contentType string
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		raw, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"partialSuccess":{}}`)
+	}))
+	defer server.Close()
+
+	o := newOptions([]Option{WithProtocol(ProtocolHTTPJSON), WithOTLPEndpoint(server.URL)})
+	exporter, err := newOTLPSpanExporter(context.Background(), o.resolveSignal("", "", tracesPath), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := provider.Tracer("test").Start(context.Background(), "publish")
+	span.End()
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	var exported map[string]any
+	for _, rs := range body["resourceSpans"].([]any) {
+		for _, ss := range rs.(map[string]any)["scopeSpans"].([]any) {
+			exported = ss.(map[string]any)["spans"].([]any)[0].(map[string]any)
+		}
+	}
+	if exported == nil {
+		t.Fatal("no span exported")
+	}
+	if got, want := exported["traceId"], span.SpanContext().TraceID().String(); got != want {
+		t.Errorf("traceId = %v, want the hex id %s", got, want)
+	}
+	if got, want := exported["spanId"], span.SpanContext().SpanID().String(); got != want {
+		t.Errorf("spanId = %v, want the hex id %s", got, want)
+	}
+	if kind, ok := exported["kind"].(float64); !ok || kind != 1 {
+		t.Errorf("kind = %v, want the enum number 1", exported["kind"])
+	}
+}
@@ -0,0 +1,107 @@
+package pulsarotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Signal names reported by ExportError
+const (
+	signalTraces  = "traces"
+	signalMetrics = "metrics"
+	signalLogs    = "logs"
+)
+
+// exportFailures tracks the consecutive failed exports of a signal
+type exportFailures struct {
+	count int
+	last  error
+}
+
+// exportHealth records the consecutive failed exports of every signal. A
+// signal is reported unhealthy once threshold exports in a row failed, so
+// that a single dropped batch does not fail the readiness probe.
+type exportHealth struct {
+	threshold int
+
+	mu       sync.Mutex
+	failures map[string]exportFailures
+}
+
+func (h *exportHealth) record(signal string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failures == nil {
+		h.failures = make(map[string]exportFailures)
+	}
+	if err == nil {
+		delete(h.failures, signal)
+		return
+	}
+	f := h.failures[signal]
+	h.failures[signal] = exportFailures{count: f.count + 1, last: err}
+}
+
+// err returns the last errors of the signals whose exports failed threshold
+// times in a row
+func (h *exportHealth) err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var errs []error
+	for _, signal := range []string{signalTraces, signalMetrics, signalLogs} {
+		if f := h.failures[signal]; f.count > 0 && f.count >= h.threshold {
+			errs = append(errs, fmt.Errorf("last %d %s exports failed: %w", f.count, signal, f.last))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ExportError returns the last errors of the signals whose exports failed as
+// many times in a row as the threshold set with WithExportFailureThreshold,
+// or nil when every signal exports, recovered or has not exported yet
+func (t *Telemetry) ExportError() error {
+	return t.health.err()
+}
+
+// healthSpanExporter records the outcome of every span export
+type healthSpanExporter struct {
+	sdktrace.SpanExporter
+	health *exportHealth
+}
+
+func (e healthSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.health.record(signalTraces, err)
+	return err
+}
+
+// healthMetricExporter records the outcome of every metric export
+type healthMetricExporter struct {
+	sdkmetric.Exporter
+	health *exportHealth
+}
+
+func (e healthMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	err := e.Exporter.Export(ctx, rm)
+	e.health.record(signalMetrics, err)
+	return err
+}
+
+// healthLogExporter records the outcome of every log export
+type healthLogExporter struct {
+	sdklog.Exporter
+	health *exportHealth
+}
+
+func (e healthLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	err := e.Exporter.Export(ctx, records)
+	e.health.record(signalLogs, err)
+	return err
+}
@@ -0,0 +1,40 @@
+package pulsarotel
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExportHealthThreshold(t *testing.T) {
+	failed := errors.New("connection refused")
+	tests := []struct {
+		name    string
+		exports []error
+		wantErr bool
+	}{
+		{"no export yet", nil, false},
+		{"single failure", []error{failed}, false},
+		{"failures below the threshold", []error{failed, failed}, false},
+		{"consecutive failures", []error{failed, failed, failed}, true},
+		{"recovered", []error{failed, failed, failed, nil}, false},
+		{"failures interrupted by a success", []error{failed, failed, nil, failed, failed}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &exportHealth{threshold: 3}
+			for _, err := range tt.exports {
+				h.record(signalTraces, err)
+			}
+			// The other signals do not count towards the threshold
+			h.record(signalMetrics, failed)
+
+			err := h.err()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err() = %v, want an error: %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, failed) {
+				t.Errorf("err() = %v, want the last export error", err)
+			}
+		})
+	}
+}
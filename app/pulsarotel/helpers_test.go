@@ -0,0 +1,223 @@
+package pulsarotel
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// fakeProducer is the part of a pulsar.Producer used by Send and SendAsync,
+// keeping the messages it acknowledges
+type fakeProducer struct {
+	pulsar.Producer
+
+	mu       sync.Mutex
+	messages []*pulsar.ProducerMessage
+}
+
+func (*fakeProducer) Topic() string { return "test-topic" }
+func (*fakeProducer) Name() string  { return "test-producer" }
+
+func (p *fakeProducer) Send(_ context.Context, msg *pulsar.ProducerMessage) (pulsar.MessageID, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, msg)
+	return pulsar.EarliestMessageID(), nil
+}
+
+func (p *fakeProducer) SendAsync(_ context.Context, msg *pulsar.ProducerMessage,
+	callback func(pulsar.MessageID, *pulsar.ProducerMessage, error)) {
+	p.mu.Lock()
+	p.messages = append(p.messages, msg)
+	p.mu.Unlock()
+	callback(pulsar.EarliestMessageID(), msg, nil)
+}
+
+// fakeConsumer is the part of a pulsar.Consumer used by Process
+type fakeConsumer struct {
+	pulsar.Consumer
+}
+
+func (fakeConsumer) Subscription() string     { return "test-subscription" }
+func (fakeConsumer) Name() string             { return "test-consumer" }
+func (fakeConsumer) Ack(pulsar.Message) error { return nil }
+func (fakeConsumer) Nack(pulsar.Message)      {}
+
+// fakeMessage is the part of a pulsar.Message used by Process
+type fakeMessage struct {
+	pulsar.Message
+
+	properties map[string]string
+}
+
+func (m fakeMessage) Properties() map[string]string { return m.properties }
+func (fakeMessage) Payload() []byte                 { return []byte(`{"content":"hello"}`) }
+func (fakeMessage) ID() pulsar.MessageID            { return pulsar.EarliestMessageID() }
+func (fakeMessage) EventTime() time.Time            { return time.Unix(0, 0) }
+func (fakeMessage) PublishTime() time.Time          { return time.Now() }
+
+// keyedMessage is a fakeMessage with a key and a sequence number
+type keyedMessage struct {
+	fakeMessage
+
+	key string
+	seq int
+}
+
+func (m keyedMessage) Key() string       { return m.key }
+func (keyedMessage) OrderingKey() string { return "" }
+
+// queueConsumer is a fakeConsumer receiving the messages sent to its channel
+// and counting the messages received and acknowledged
+type queueConsumer struct {
+	fakeConsumer
+
+	messages chan pulsar.Message
+	received atomic.Int64
+	acked    atomic.Int64
+}
+
+func newQueueConsumer() *queueConsumer {
+	return &queueConsumer{messages: make(chan pulsar.Message, 100)}
+}
+
+func (c *queueConsumer) Receive(ctx context.Context) (pulsar.Message, error) {
+	select {
+	case msg := <-c.messages:
+		c.received.Add(1)
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *queueConsumer) Ack(pulsar.Message) error {
+	c.acked.Add(1)
+	return nil
+}
+
+// waitFor polls condition until it holds, failing the test after 5 seconds
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newTestTelemetry returns a Telemetry recording its spans, sampled by
+// sampler, and the global propagator set to W3C trace context and baggage
+func newTestTelemetry(t *testing.T, sampler sdktrace.Sampler) (*Telemetry, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	metrics, err := newInstruments(noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	return &Telemetry{
+		tracerProvider: tp,
+		tracer:         tp.Tracer("test"),
+		metrics:        metrics,
+		logger:         zap.NewNop(),
+		metricNames:    MetricNamesSemconv,
+	}, recorder
+}
+
+// processSpan returns the single process span recorded
+func processSpan(t *testing.T, recorder *tracetest.SpanRecorder) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "process test-topic" {
+		t.Errorf("span name = %q, want %q", span.Name(), "process test-topic")
+	}
+	if span.SpanKind() != trace.SpanKindConsumer {
+		t.Errorf("span kind = %v, want %v", span.SpanKind(), trace.SpanKindConsumer)
+	}
+	return span
+}
+
+// recordMetrics makes tel record its instruments in the returned reader
+func recordMetrics(t *testing.T, tel *Telemetry) *sdkmetric.ManualReader {
+	t.Helper()
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+
+	metrics, err := newInstruments(mp.Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tel.metrics = metrics
+	return reader
+}
+
+// int64Value returns the value of the int64 gauge or counter name recorded
+// with attrs, and whether it was recorded
+func int64Value(t *testing.T, reader *sdkmetric.ManualReader, name string, attrs ...attribute.KeyValue) (int64, bool) {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	want := attribute.NewSet(attrs...)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			var points []metricdata.DataPoint[int64]
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				points = data.DataPoints
+			case metricdata.Sum[int64]:
+				points = data.DataPoints
+			}
+			for _, point := range points {
+				if point.Attributes.Equals(&want) {
+					return point.Value, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,347 @@
+package pulsarotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// Payload size distributions accepted in PayloadSize.Distribution
+const (
+	DistributionFixed   = "fixed"
+	DistributionUniform = "uniform"
+	DistributionNormal  = "normal"
+)
+
+// loadTick is how often the load generator schedules the messages due
+const loadTick = 5 * time.Millisecond
+
+// LoadProfile describes the load published by a LoadGenerator
+type LoadProfile struct {
+	// Rate is the target rate in messages per second
+	Rate float64
+	// RampUp is the time taken to increase the rate linearly from zero to Rate
+	RampUp time.Duration
+	// RampDown is the time taken to decrease the rate linearly to zero at the
+	// end of Duration
+	RampDown time.Duration
+
+	// BurstRate is the rate of the bursts starting every BurstInterval and
+	// lasting BurstDuration, no bursts when zero
+	BurstRate     float64
+	BurstInterval time.Duration
+	BurstDuration time.Duration
+
+	// PayloadSize is the distribution of the size of the message contents
+	PayloadSize PayloadSize
+	// Keys is the number of distinct message keys, picked at random; messages
+	// have no key when zero
+	Keys int
+
+	// Duration and Count stop the generator once elapsed or published,
+	// unlimited when zero
+	Duration time.Duration
+	Count    int64
+
+	// Workers is the number of goroutines publishing with SendAsync
+	Workers int
+}
+
+// PayloadSize is a distribution of payload sizes in bytes. Fixed sizes are
+// Max, uniform sizes are between Min and Max, and normal sizes are centered
+// between Min and Max with a standard deviation of a sixth of the range,
+// bounded by Min and Max.
+type PayloadSize struct {
+	Distribution string
+	Min          int
+	Max          int
+}
+
+// Validate checks the profile, as NewLoadGenerator does
+func (p LoadProfile) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(p.Rate > 0, "rate must be positive")
+	check(p.RampUp >= 0 && p.RampDown >= 0, "ramps must not be negative")
+	check(p.Duration >= 0 && p.Count >= 0, "duration and count must not be negative")
+	check(p.RampDown == 0 || p.Duration > 0, "ramp down requires a duration")
+	check(p.Duration == 0 || p.RampUp+p.RampDown <= p.Duration, "ramps must fit in the duration")
+	if p.BurstRate != 0 {
+		check(p.BurstRate > 0, "burst rate must not be negative")
+		check(p.BurstDuration > 0 && p.BurstDuration < p.BurstInterval,
+			"burst duration must be positive and shorter than the burst interval")
+	}
+	distributions := []string{DistributionFixed, DistributionUniform, DistributionNormal}
+	check(slices.Contains(distributions, p.PayloadSize.Distribution),
+		"payload size distribution %q must be one of %s", p.PayloadSize.Distribution, strings.Join(distributions, ", "))
+	check(p.PayloadSize.Min >= 0 && p.PayloadSize.Max >= p.PayloadSize.Min,
+		"payload sizes must satisfy 0 <= min <= max")
+	check(p.Keys >= 0, "keys must not be negative")
+	check(p.Workers > 0, "workers must be positive")
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid load profile: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// rateAt returns the target rate at elapsed time t, zero once Duration elapsed
+func (p LoadProfile) rateAt(t time.Duration) float64 {
+	if p.Duration > 0 && t >= p.Duration {
+		return 0
+	}
+	rate := p.Rate
+	if p.RampUp > 0 && t < p.RampUp {
+		rate *= float64(t) / float64(p.RampUp)
+	}
+	if p.RampDown > 0 {
+		if left := p.Duration - t; left < p.RampDown {
+			rate = min(rate, p.Rate*float64(max(left, 0))/float64(p.RampDown))
+		}
+	}
+	if p.BurstRate > 0 && t >= p.BurstInterval && t%p.BurstInterval < p.BurstDuration {
+		rate = max(rate, p.BurstRate)
+	}
+	return rate
+}
+
+// next returns a payload size drawn from the distribution
+func (s PayloadSize) next() int {
+	switch s.Distribution {
+	case DistributionUniform:
+		return s.Min + rand.IntN(s.Max-s.Min+1)
+	case DistributionNormal:
+		mean := float64(s.Min+s.Max) / 2
+		size := mean + rand.NormFloat64()*float64(s.Max-s.Min)/6
+		return min(max(int(math.Round(size)), s.Min), s.Max)
+	default:
+		return s.Max
+	}
+}
+
+// loadJob is a message scheduled by the load generator
+type loadJob struct {
+	seq       int64
+	scheduled time.Time
+}
+
+// LoadGenerator publishes values of type T through a TypedProducer following
+// a LoadProfile, to load test a Pulsar cluster. Messages are scheduled at the
+// target rate independently of how fast they are published, and published
+// with SendAsync by several workers. The generator records the target and
+// achieved rates in pulsar.loadgen.rate.target and
+// pulsar.loadgen.rate.achieved, and in pulsar.loadgen.queueing.delay the time
+// from the scheduled send time of every message until a worker starts sending
+// it. That delay grows when the workers cannot keep up, including when a full
+// producer pending queue blocks them in SendAsync.
+type LoadGenerator[T any] struct {
+	tel      *Telemetry
+	producer *TypedProducer[T]
+	profile  LoadProfile
+	newValue func(id string, content string) *T
+	content  string
+	// attrs are the attributes of the generator metrics
+	attrs metric.MeasurementOption
+
+	scheduled atomic.Int64
+	acked     atomic.Int64
+	failed    atomic.Int64
+}
+
+// NewLoadGenerator creates a generator publishing through producer the values
+// returned by newValue, for a message id and a content whose size follows the
+// payload size distribution of profile
+func NewLoadGenerator[T any](t *Telemetry, producer *TypedProducer[T], profile LoadProfile,
+	newValue func(id string, content string) *T) (*LoadGenerator[T], error) {
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	// Contents are slices of a single random text
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	content := make([]byte, profile.PayloadSize.Max)
+	for i := range content {
+		content[i] = letters[rand.IntN(len(letters))]
+	}
+	return &LoadGenerator[T]{
+		tel:      t,
+		producer: producer,
+		profile:  profile,
+		newValue: newValue,
+		content:  string(content),
+		attrs:    t.loadAttributes(producer.Topic()),
+	}, nil
+}
+
+// Run publishes the load until the profile duration or count is reached or
+// ctx is done. It returns once every scheduled message has been handed to
+// the producer, without waiting for the broker acknowledgements; flush the
+// producer to wait for them. Messages handed over are not cancelled with ctx.
+func (g *LoadGenerator[T]) Run(ctx context.Context) {
+	start := time.Now()
+	g.tel.logger.Info("Starting load generation",
+		zap.String("topic", g.producer.Topic()),
+		zap.Float64("rate", g.profile.Rate),
+		zap.Duration("duration", g.profile.Duration),
+		zap.Int64("count", g.profile.Count),
+		zap.Int("workers", g.profile.Workers))
+
+	reportCtx, stopReporting := context.WithCancel(ctx)
+	var reporting sync.WaitGroup
+	reporting.Add(1)
+	go func() {
+		defer reporting.Done()
+		g.report(reportCtx, start)
+	}()
+
+	jobs := make(chan loadJob, g.profile.Workers)
+	var workers sync.WaitGroup
+	for range g.profile.Workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			g.work(ctx, jobs)
+		}()
+	}
+
+	g.schedule(ctx, start, jobs)
+	close(jobs)
+	workers.Wait()
+	stopReporting()
+	reporting.Wait()
+
+	elapsed := time.Since(start)
+	g.tel.logger.Info("Load generation complete",
+		zap.String("topic", g.producer.Topic()),
+		zap.Int64("scheduled", g.scheduled.Load()),
+		zap.Int64("acknowledged", g.acked.Load()),
+		zap.Int64("failed", g.failed.Load()),
+		zap.Duration("elapsed", elapsed),
+		zap.Float64("achieved_rate", float64(g.acked.Load())/elapsed.Seconds()))
+}
+
+// schedule sends the jobs due at every tick to the workers. Send times are
+// interpolated within the tick, so that a tick delayed by busy workers still
+// schedules its messages at their intended times.
+func (g *LoadGenerator[T]) schedule(ctx context.Context, start time.Time, jobs chan<- loadJob) {
+	ticker := time.NewTicker(loadTick)
+	defer ticker.Stop()
+
+	last := start
+	var credits float64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		if g.profile.Duration > 0 && now.Sub(start) >= g.profile.Duration {
+			return
+		}
+
+		rate := g.profile.rateAt(last.Sub(start) + now.Sub(last)/2)
+		before := credits
+		credits += rate * now.Sub(last).Seconds()
+		for n := math.Floor(before) + 1; n <= credits; n++ {
+			// Only this goroutine schedules, a job is counted once handed over
+			job := loadJob{
+				seq:       g.scheduled.Load() + 1,
+				scheduled: last.Add(time.Duration((n - before) / rate * float64(time.Second))),
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- job:
+				g.scheduled.Add(1)
+			}
+			if g.profile.Count > 0 && job.seq >= g.profile.Count {
+				return
+			}
+		}
+		last = now
+	}
+}
+
+// work publishes the scheduled jobs
+func (g *LoadGenerator[T]) work(ctx context.Context, jobs <-chan loadJob) {
+	for job := range jobs {
+		id := fmt.Sprintf("msg-%d", job.seq)
+		msg := &pulsar.ProducerMessage{
+			Properties: map[string]string{"message_id": id},
+		}
+		if g.profile.Keys > 0 {
+			msg.Key = fmt.Sprintf("key-%d", rand.IntN(g.profile.Keys))
+		}
+		value := g.newValue(id, g.content[:g.profile.PayloadSize.next()])
+
+		// Measured as the send starts, SendValueAsync may block on a full
+		// pending queue
+		g.tel.recordQueueingDelay(ctx, time.Since(job.scheduled), g.attrs)
+		g.producer.SendValueAsync(ctx, value, msg, func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+			if err != nil {
+				g.failed.Add(1)
+				return
+			}
+			g.acked.Add(1)
+		})
+	}
+}
+
+// report records the target and achieved rates every second until ctx is
+// done
+func (g *LoadGenerator[T]) report(ctx context.Context, start time.Time) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	last, lastAcked := start, int64(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			acked := g.acked.Load()
+			achieved := float64(acked-lastAcked) / now.Sub(last).Seconds()
+			g.tel.recordLoadRates(ctx, g.profile.rateAt(now.Sub(start)), achieved, g.attrs)
+			last, lastAcked = now, acked
+		}
+	}
+}
+
+// loadAttributes returns the attributes of the load generator metrics for
+// topic, named like the ones of the publish metrics selected with
+// WithMetricNames. The topic is recorded once: MetricNamesBoth uses the
+// messaging.* attributes only, which name it in messaging.destination.name.
+func (t *Telemetry) loadAttributes(topic string) metric.MeasurementOption {
+	if t.metricNames.semconv() {
+		return metric.WithAttributeSet(attribute.NewSet(t.messagingAttributes(operationSend, topic, "", true)...))
+	}
+	return metric.WithAttributeSet(attribute.NewSet(attribute.String("topic", topic)))
+}
+
+// recordLoadRates records the target rate of the load generator and the rate
+// of acknowledged messages it achieved
+func (t *Telemetry) recordLoadRates(ctx context.Context, target float64, achieved float64, attrs metric.MeasurementOption) {
+	t.metrics.loadTargetRate.Record(ctx, target, attrs)
+	t.metrics.loadAchievedRate.Record(ctx, achieved, attrs)
+}
+
+// recordQueueingDelay records the time from the scheduled send time of a
+// message until a worker started sending it
+func (t *Telemetry) recordQueueingDelay(ctx context.Context, delay time.Duration, attrs metric.MeasurementOption) {
+	t.metrics.loadQueueingDelay.Record(ctx, delay.Seconds(), attrs)
+}
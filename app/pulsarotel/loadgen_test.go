@@ -0,0 +1,170 @@
+package pulsarotel
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+type testValue struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+}
+
+func TestLoadGeneratorPublishesCount(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+	reader := recordMetrics(t, tel)
+	fake := &fakeProducer{}
+	codec, err := NewJSONCodec[testValue](`{"type":"record","name":"TestValue","fields":[` +
+		`{"name":"id","type":"string"},{"name":"content","type":"string"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer := NewTypedProducer(tel.NewTracedProducer(fake), codec)
+
+	generator, err := NewLoadGenerator(tel, producer, LoadProfile{
+		Rate:        2000,
+		PayloadSize: PayloadSize{Distribution: DistributionUniform, Min: 10, Max: 20},
+		Keys:        3,
+		Count:       100,
+		Workers:     4,
+	}, func(id string, content string) *testValue {
+		return &testValue{ID: id, Content: content}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	generator.Run(ctx)
+
+	if len(fake.messages) != 100 {
+		t.Fatalf("published %d messages, want 100", len(fake.messages))
+	}
+	if got := generator.acked.Load(); got != 100 {
+		t.Errorf("acknowledged %d messages, want 100", got)
+	}
+	if got := queueingDelayCount(t, reader, "test-topic"); got != 100 {
+		t.Errorf("pulsar.loadgen.queueing.delay recorded %d messages of test-topic, want 100", got)
+	}
+	for _, msg := range fake.messages {
+		suffix, ok := strings.CutPrefix(msg.Key, "key-")
+		if n, err := strconv.Atoi(suffix); !ok || err != nil || n < 0 || n > 2 {
+			t.Errorf("key = %q, want one of key-0 to key-2", msg.Key)
+		}
+		var value testValue
+		if err := json.Unmarshal(msg.Payload, &value); err != nil {
+			t.Fatal(err)
+		}
+		if value.ID != msg.Properties["message_id"] {
+			t.Errorf("value id = %q, want the message_id property %q", value.ID, msg.Properties["message_id"])
+		}
+		if n := len(value.Content); n < 10 || n > 20 {
+			t.Errorf("content size = %d, want between 10 and 20", n)
+		}
+	}
+}
+
+// queueingDelayCount returns the number of queueing delays recorded for topic
+// with the semconv destination attribute
+func queueingDelayCount(t *testing.T, reader *sdkmetric.ManualReader, topic string) uint64 {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var count uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "pulsar.loadgen.queueing.delay" {
+				continue
+			}
+			for _, point := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+				if value, _ := point.Attributes.Value(semconv.MessagingDestinationNameKey); value.AsString() == topic {
+					count += point.Count
+				}
+			}
+		}
+	}
+	return count
+}
+
+func TestLoadProfileRate(t *testing.T) {
+	profile := LoadProfile{
+		Rate:          100,
+		RampUp:        10 * time.Second,
+		RampDown:      10 * time.Second,
+		BurstRate:     500,
+		BurstInterval: 30 * time.Second,
+		BurstDuration: 5 * time.Second,
+		Duration:      time.Minute,
+	}
+	tests := []struct {
+		at   time.Duration
+		want float64
+	}{
+		{0, 0},
+		{5 * time.Second, 50},
+		{20 * time.Second, 100},
+		{32 * time.Second, 500},
+		{45 * time.Second, 100},
+		{55 * time.Second, 50},
+		{time.Minute, 0},
+	}
+	for _, tt := range tests {
+		if got := profile.rateAt(tt.at); got != tt.want {
+			t.Errorf("rate at %s = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestLoadAttributesNameTopicOnce(t *testing.T) {
+	tests := []struct {
+		names MetricNames
+		want  attribute.Key
+	}{
+		{MetricNamesSemconv, semconv.MessagingDestinationNameKey},
+		{MetricNamesLegacy, "topic"},
+		{MetricNamesBoth, semconv.MessagingDestinationNameKey},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.names), func(t *testing.T) {
+			tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+			tel.metricNames = tt.names
+			reader := recordMetrics(t, tel)
+			tel.recordQueueingDelay(context.Background(), time.Millisecond, tel.loadAttributes("test-topic"))
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(context.Background(), &rm); err != nil {
+				t.Fatal(err)
+			}
+			var attrs []attribute.KeyValue
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					if m.Name == "pulsar.loadgen.queueing.delay" {
+						attrs = m.Data.(metricdata.Histogram[float64]).DataPoints[0].Attributes.ToSlice()
+					}
+				}
+			}
+			var topics []attribute.KeyValue
+			for _, attr := range attrs {
+				if attr.Value.AsString() == "test-topic" {
+					topics = append(topics, attr)
+				}
+			}
+			if len(topics) != 1 || topics[0].Key != tt.want {
+				t.Errorf("topic attributes = %v, want the topic once in %s", topics, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package pulsarotel
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/contrib/bridges/otelzap"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// contextFieldKey is the key of the field added by ContextField
+const contextFieldKey = "context"
+
+// newLoggerProvider creates a logger provider exporting to OTLP when an
+// endpoint is configured and to stdout otherwise
+func newLoggerProvider(ctx context.Context, res *resource.Resource, o *options, health *exportHealth) (*sdklog.LoggerProvider, error) {
+	var exporter sdklog.Exporter
+	var err error
+	if signal := o.resolveSignal(o.otlpLogsEndpoint, o.otlpLogsProtocol, logsPath); signal.endpoint != "" {
+		// Create the OTLP exporter for the configured protocol
+		exporter, err = newOTLPLogExporter(ctx, signal, o)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP log exporter: %w", err)
+		}
+		o.logger.Info("Using OTLP logs exporter",
+			zap.String("endpoint", signal.endpoint),
+			zap.String("protocol", string(signal.protocol)),
+		)
+	} else {
+		// Fall back to stdout exporter
+		exporter, err = stdoutlog.New()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout log exporter: %w", err)
+		}
+		o.logger.Info("Using stdout logs exporter")
+	}
+
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(healthLogExporter{Exporter: exporter, health: health})),
+		sdklog.WithResource(res),
+	)
+	return lp, nil
+}
+
+// newBridgedLogger tees the entries of logger into the OpenTelemetry logs
+// pipeline. Entries written to the original core get trace_id and span_id
+// fields in place of the ContextField, while the OpenTelemetry records carry
+// the trace and span IDs natively. Both get the fields the context carries,
+// such as the baggage allowlisted with WithBaggageKeys.
+func newBridgedLogger(logger *zap.Logger, lp *sdklog.LoggerProvider, name string) *zap.Logger {
+	otelCore := otelzap.NewCore(name, otelzap.WithLoggerProvider(lp))
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(correlationCore{Core: core}, correlationCore{Core: otelCore, keepContext: true})
+	}))
+}
+
+// ContextField returns a zap field carrying ctx. Log entries written with it
+// are correlated with the span active in ctx, without adding the IDs by hand:
+//
+//	logger.Info("Received message", pulsarotel.ContextField(ctx))
+func ContextField(ctx context.Context) zap.Field {
+	return zap.Field{Key: contextFieldKey, Type: zapcore.SkipType, Interface: ctx}
+}
+
+// correlationCore replaces context fields with trace_id and span_id fields
+// before handing entries to the wrapped core, so console output stays
+// correlated with the exported traces. With keepContext the context fields
+// are kept for the wrapped core to read the span from.
+type correlationCore struct {
+	zapcore.Core
+
+	keepContext bool
+}
+
+func (c correlationCore) With(fields []zapcore.Field) zapcore.Core {
+	return correlationCore{Core: c.Core.With(c.correlationFields(fields)), keepContext: c.keepContext}
+}
+
+func (c correlationCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c correlationCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, c.correlationFields(fields))
+}
+
+// correlationFields returns fields with every context field replaced by the
+// trace_id and span_id of the span it carries, followed by the fields added
+// to the context
+func (c correlationCore) correlationFields(fields []zapcore.Field) []zapcore.Field {
+	out := fields[:0:0]
+	for _, field := range fields {
+		ctx, ok := field.Interface.(context.Context)
+		if !ok {
+			out = append(out, field)
+			continue
+		}
+		out = append(out, logFieldsFromContext(ctx)...)
+		if c.keepContext {
+			out = append(out, field)
+			continue
+		}
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			out = append(out,
+				zap.String("trace_id", sc.TraceID().String()),
+				zap.String("span_id", sc.SpanID().String()))
+		}
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package pulsarotel
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// recordingLogExporter keeps the log records it exports
+type recordingLogExporter struct {
+	mu      sync.Mutex
+	records []sdklog.Record
+}
+
+func (e *recordingLogExporter) Export(_ context.Context, records []sdklog.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, record := range records {
+		e.records = append(e.records, record.Clone())
+	}
+	return nil
+}
+
+func (*recordingLogExporter) Shutdown(context.Context) error   { return nil }
+func (*recordingLogExporter) ForceFlush(context.Context) error { return nil }
+
+func TestBridgedLoggerCorrelation(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(logger *zap.Logger, ctx context.Context)
+	}{
+		{"entry field", func(logger *zap.Logger, ctx context.Context) {
+			logger.Info("Received message", ContextField(ctx))
+		}},
+		{"logger field", func(logger *zap.Logger, ctx context.Context) {
+			logger.With(ContextField(ctx)).Info("Received message")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.InfoLevel)
+			exporter := &recordingLogExporter{}
+			lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(exporter)))
+			t.Cleanup(func() { _ = lp.Shutdown(context.Background()) })
+			logger := newBridgedLogger(zap.New(core), lp, "test")
+
+			tp := sdktrace.NewTracerProvider()
+			t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+			ctx, span := tp.Tracer("test").Start(context.Background(), "process test-topic")
+			defer span.End()
+			sc := span.SpanContext()
+
+			tt.log(logger, ctx)
+
+			// The console entry gets the IDs as fields in place of the context
+			entries := logs.All()
+			if len(entries) != 1 {
+				t.Fatalf("logged %d console entries, want 1", len(entries))
+			}
+			fields := entries[0].ContextMap()
+			if got := fields["trace_id"]; got != sc.TraceID().String() {
+				t.Errorf("trace_id = %v, want %s", got, sc.TraceID())
+			}
+			if got := fields["span_id"]; got != sc.SpanID().String() {
+				t.Errorf("span_id = %v, want %s", got, sc.SpanID())
+			}
+			if _, ok := fields[contextFieldKey]; ok {
+				t.Errorf("console entry keeps the %s field", contextFieldKey)
+			}
+
+			// The OpenTelemetry record carries them natively
+			exporter.mu.Lock()
+			defer exporter.mu.Unlock()
+			if len(exporter.records) != 1 {
+				t.Fatalf("exported %d log records, want 1", len(exporter.records))
+			}
+			record := exporter.records[0]
+			if record.TraceID() != sc.TraceID() || record.SpanID() != sc.SpanID() {
+				t.Errorf("record trace and span = %s %s, want %s %s",
+					record.TraceID(), record.SpanID(), sc.TraceID(), sc.SpanID())
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package pulsarotel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.uber.org/zap"
+)
+
+// instruments groups the metric instruments recorded by the instrumentation
+type instruments struct {
+	messagesPublished      metric.Int64Counter
+	messagesConsumed       metric.Int64Counter
+	messagePublishLatency  metric.Float64Histogram
+	messageConsumeLatency  metric.Float64Histogram
+	messageEndToEndLatency metric.Float64Histogram
+
+	// Messaging client metrics of the semantic conventions
+	clientSentMessages      metric.Int64Counter
+	clientConsumedMessages  metric.Int64Counter
+	clientOperationDuration metric.Float64Histogram
+	processDuration         metric.Float64Histogram
+
+	activePulsarConnections metric.Int64UpDownCounter
+	messagesRetried         metric.Int64Counter
+	messagesDeadLettered    metric.Int64Counter
+	codecErrors             metric.Int64Counter
+	contractViolations      metric.Int64Counter
+	busyWorkers             metric.Int64UpDownCounter
+	queueDepth              metric.Int64UpDownCounter
+
+	// Topic statistics polled from the Pulsar admin API
+	subscriptionBacklog   metric.Int64Gauge
+	subscriptionConsumers metric.Int64Gauge
+	topicMsgRateIn        metric.Float64Gauge
+	topicMsgRateOut       metric.Float64Gauge
+	topicStorageSize      metric.Int64Gauge
+
+	// TLS certificates of the Pulsar connection
+	certificateExpiry  metric.Float64Gauge
+	certificateReloads metric.Int64Counter
+
+	// Tokens authenticating the Pulsar connection
+	tokenRefreshes metric.Int64Counter
+
+	// Load generator
+	loadTargetRate    metric.Float64Gauge
+	loadAchievedRate  metric.Float64Gauge
+	loadQueueingDelay metric.Float64Histogram
+
+	// System metrics for Elastic APM
+	systemCPUUsage    metric.Float64Gauge
+	systemMemoryUsage metric.Float64Gauge
+	systemMemoryTotal metric.Float64Gauge
+}
+
+// newMeterProvider creates a meter provider exporting to OTLP when an
+// endpoint is configured and to stdout otherwise. With WithPrometheus, a
+// Prometheus reader is added and its handler returned.
+func newMeterProvider(ctx context.Context, res *resource.Resource, o *options, health *exportHealth) (*sdkmetric.MeterProvider, http.Handler, error) {
+	var reader sdkmetric.Reader
+	if signal := o.resolveSignal(o.otlpMetricsEndpoint, o.otlpMetricsProtocol, metricsPath); signal.endpoint != "" {
+		// Create the OTLP exporter for the configured protocol
+		exporter, err := newOTLPMetricExporter(ctx, signal, o)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+		}
+
+		// Set a specific interval for the periodic reader to ensure metrics are pushed regularly
+		reader = sdkmetric.NewPeriodicReader(healthMetricExporter{Exporter: exporter, health: health},
+			sdkmetric.WithInterval(o.metricExportInterval),
+			sdkmetric.WithTimeout(o.metricExportTimeout),
+		)
+		o.logger.Info("Using OTLP metrics exporter",
+			zap.String("endpoint", signal.endpoint),
+			zap.String("protocol", string(signal.protocol)),
+			zap.Duration("push_interval", o.metricExportInterval),
+		)
+	} else {
+		// Fall back to stdout exporter
+		exporter, err := stdoutmetric.New()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create stdout metric exporter: %w", err)
+		}
+		reader = sdkmetric.NewPeriodicReader(healthMetricExporter{Exporter: exporter, health: health},
+			sdkmetric.WithInterval(o.metricExportInterval),
+			sdkmetric.WithTimeout(o.metricExportTimeout),
+		)
+		o.logger.Info("Using stdout metrics exporter", zap.Duration("push_interval", o.metricExportInterval))
+	}
+
+	// Create a new meter provider with the exporter
+	mpOpts := []sdkmetric.Option{
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(res),
+		// Add view to ensure no aggregation issues
+		sdkmetric.WithView(sdkmetric.NewView(
+			sdkmetric.Instrument{Kind: sdkmetric.InstrumentKindUpDownCounter},
+			sdkmetric.Stream{Aggregation: sdkmetric.AggregationSum{}},
+		)),
+	}
+
+	// Serve the same instruments to Prometheus scrapes alongside the push reader
+	var promHandler http.Handler
+	if o.prometheus {
+		promReader, handler, err := newPrometheusReader()
+		if err != nil {
+			return nil, nil, err
+		}
+		mpOpts = append(mpOpts, sdkmetric.WithReader(promReader))
+		promHandler = handler
+		o.logger.Info("Using Prometheus metrics reader")
+	}
+
+	return sdkmetric.NewMeterProvider(mpOpts...), promHandler, nil
+}
+
+// durationBuckets are the histogram boundaries, in seconds, advised by the
+// semantic conventions for the messaging durations
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// newInstruments creates the metric instruments on the given meter
+func newInstruments(meter metric.Meter) (*instruments, error) {
+	ins := &instruments{}
+
+	var err1, err2, err3, err4, err5 error
+	ins.messagesPublished, err1 = meter.Int64Counter(
+		"pulsar.messages.published",
+		metric.WithDescription("Total number of messages published"),
+		metric.WithUnit("{messages}"),
+	)
+
+	ins.messagesConsumed, err2 = meter.Int64Counter(
+		"pulsar.messages.consumed",
+		metric.WithDescription("Total number of messages consumed"),
+		metric.WithUnit("{messages}"),
+	)
+
+	ins.messagePublishLatency, err3 = meter.Float64Histogram(
+		"pulsar.message.publish.latency",
+		metric.WithDescription("Latency of publishing messages"),
+		metric.WithUnit("ms"),
+	)
+
+	ins.messageConsumeLatency, err4 = meter.Float64Histogram(
+		"pulsar.message.consume.latency",
+		metric.WithDescription("Latency of consuming messages"),
+		metric.WithUnit("ms"),
+	)
+
+	var errE2E error
+	ins.messageEndToEndLatency, errE2E = meter.Float64Histogram(
+		"pulsar.message.e2e.latency",
+		metric.WithDescription("Latency from the message event or publish time to the end of its processing"),
+		metric.WithUnit("ms"),
+	)
+
+	var errSent, errConsumed, errOperation, errProcess error
+	ins.clientSentMessages, errSent = meter.Int64Counter(
+		"messaging.client.sent.messages",
+		metric.WithDescription("Number of messages producer attempted to send to the broker"),
+		metric.WithUnit("{message}"),
+	)
+
+	ins.clientConsumedMessages, errConsumed = meter.Int64Counter(
+		"messaging.client.consumed.messages",
+		metric.WithDescription("Number of messages that were delivered to the application"),
+		metric.WithUnit("{message}"),
+	)
+
+	ins.clientOperationDuration, errOperation = meter.Float64Histogram(
+		"messaging.client.operation.duration",
+		metric.WithDescription("Duration of messaging operation initiated by a producer or consumer client"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+
+	ins.processDuration, errProcess = meter.Float64Histogram(
+		"messaging.process.duration",
+		metric.WithDescription("Duration of processing operation"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+
+	ins.activePulsarConnections, err5 = meter.Int64UpDownCounter(
+		"pulsar.connections.active",
+		metric.WithDescription("Number of active connections to Pulsar"),
+		metric.WithUnit("{connections}"),
+	)
+
+	var errRetried, errDeadLettered error
+	ins.messagesRetried, errRetried = meter.Int64Counter(
+		"pulsar.messages.retried",
+		metric.WithDescription("Number of failed messages scheduled for redelivery through the retry topic"),
+		metric.WithUnit("{messages}"),
+	)
+
+	ins.messagesDeadLettered, errDeadLettered = meter.Int64Counter(
+		"pulsar.messages.dead_lettered",
+		metric.WithDescription("Number of messages routed to the dead letter topic after exhausting their retries"),
+		metric.WithUnit("{messages}"),
+	)
+
+	var errCodec error
+	ins.codecErrors, errCodec = meter.Int64Counter(
+		"pulsar.messages.codec_errors",
+		metric.WithDescription("Number of message payloads that could not be encoded or decoded"),
+		metric.WithUnit("{messages}"),
+	)
+
+	var errContract error
+	ins.contractViolations, errContract = meter.Int64Counter(
+		"messaging.contract.violations",
+		metric.WithDescription("Number of message payloads not matching the JSON Schema of their message in the AsyncAPI spec"),
+		metric.WithUnit("{messages}"),
+	)
+
+	var errBusy, errQueue error
+	ins.busyWorkers, errBusy = meter.Int64UpDownCounter(
+		"pulsar.consumer.workers.busy",
+		metric.WithDescription("Number of consumer workers processing a message"),
+		metric.WithUnit("{workers}"),
+	)
+
+	ins.queueDepth, errQueue = meter.Int64UpDownCounter(
+		"pulsar.consumer.queue.depth",
+		metric.WithDescription("Number of received messages waiting for a consumer worker"),
+		metric.WithUnit("{messages}"),
+	)
+
+	var errBacklog, errConsumers, errRateIn, errRateOut, errStorage error
+	ins.subscriptionBacklog, errBacklog = meter.Int64Gauge(
+		"pulsar.subscription.backlog",
+		metric.WithDescription("Number of messages of the subscription not yet acknowledged"),
+		metric.WithUnit("{messages}"),
+	)
+
+	ins.subscriptionConsumers, errConsumers = meter.Int64Gauge(
+		"pulsar.subscription.consumers",
+		metric.WithDescription("Number of consumers connected to the subscription"),
+		metric.WithUnit("{consumers}"),
+	)
+
+	ins.topicMsgRateIn, errRateIn = meter.Float64Gauge(
+		"pulsar.topic.msg_rate.in",
+		metric.WithDescription("Rate of messages published on the topic"),
+		metric.WithUnit("{messages}/s"),
+	)
+
+	ins.topicMsgRateOut, errRateOut = meter.Float64Gauge(
+		"pulsar.topic.msg_rate.out",
+		metric.WithDescription("Rate of messages dispatched to the subscriptions of the topic"),
+		metric.WithUnit("{messages}/s"),
+	)
+
+	ins.topicStorageSize, errStorage = meter.Int64Gauge(
+		"pulsar.topic.storage.size",
+		metric.WithDescription("Storage size of the topic"),
+		metric.WithUnit("By"),
+	)
+
+	var errExpiry, errReloads error
+	ins.certificateExpiry, errExpiry = meter.Float64Gauge(
+		"pulsar.tls.certificate.expiry",
+		metric.WithDescription("Time left until the TLS certificate expires, negative once expired"),
+		metric.WithUnit("s"),
+	)
+
+	ins.certificateReloads, errReloads = meter.Int64Counter(
+		"pulsar.tls.certificate.reloads",
+		metric.WithDescription("Number of attempts to load a rotated client certificate"),
+		metric.WithUnit("{reloads}"),
+	)
+
+	var errTokens error
+	ins.tokenRefreshes, errTokens = meter.Int64Counter(
+		"pulsar.auth.token.refreshes",
+		metric.WithDescription("Number of attempts to obtain a new OAuth2 token or read a rotated token file"),
+		metric.WithUnit("{refreshes}"),
+	)
+
+	var errTarget, errAchieved, errQueueing error
+	ins.loadTargetRate, errTarget = meter.Float64Gauge(
+		"pulsar.loadgen.rate.target",
+		metric.WithDescription("Rate of messages the load generator aims to publish"),
+		metric.WithUnit("{messages}/s"),
+	)
+
+	ins.loadAchievedRate, errAchieved = meter.Float64Gauge(
+		"pulsar.loadgen.rate.achieved",
+		metric.WithDescription("Rate of messages published by the load generator and acknowledged by the broker"),
+		metric.WithUnit("{messages}/s"),
+	)
+
+	ins.loadQueueingDelay, errQueueing = meter.Float64Histogram(
+		"pulsar.loadgen.queueing.delay",
+		metric.WithDescription("Time from the scheduled send time of a message until a worker starts sending it"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+
+	// Create system metrics for Elastic APM
+	var errCPU, errMemUsage, errMemTotal error
+
+	// CPU usage metric - using the system.cpu.usage name for Elastic APM compatibility
+	ins.systemCPUUsage, errCPU = meter.Float64Gauge(
+		"system.cpu.usage",
+		metric.WithDescription("CPU usage percentage"),
+		metric.WithUnit("1"), // 1 means a ratio/percentage in OpenTelemetry
+	)
+
+	// Memory usage metrics - using names compatible with Elastic APM
+	ins.systemMemoryUsage, errMemUsage = meter.Float64Gauge(
+		"system.memory.usage",
+		metric.WithDescription("Memory usage in bytes"),
+		metric.WithUnit("By"), // Bytes unit
+	)
+
+	ins.systemMemoryTotal, errMemTotal = meter.Float64Gauge(
+		"system.memory.total",
+		metric.WithDescription("Total system memory in bytes"),
+		metric.WithUnit("By"), // Bytes unit
+	)
+
+	// Check for errors in creating instruments
+	for _, err := range []error{err1, err2, err3, err4, errE2E, errSent, errConsumed, errOperation, errProcess, err5,
+		errRetried, errDeadLettered, errCodec, errContract, errBusy, errQueue,
+		errBacklog, errConsumers, errRateIn, errRateOut, errStorage, errExpiry, errReloads, errTokens,
+		errTarget, errAchieved, errQueueing,
+		errCPU, errMemUsage, errMemTotal} {
+		if err != nil {
+			return nil, fmt.Errorf("failed to create instrument: %w", err)
+		}
+	}
+
+	return ins, nil
+}
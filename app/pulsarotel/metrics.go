@@ -0,0 +1,224 @@
+package pulsarotel
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/mem"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.uber.org/zap"
+)
+
+// RecordPublish records the metrics for a published message, under the
+// names selected with WithMetricNames
+func (t *Telemetry) RecordPublish(ctx context.Context, duration time.Duration, topic string, success bool) {
+	if t.metricNames.legacy() {
+		attrs := metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.Bool("success", success),
+		)
+		t.metrics.messagesPublished.Add(ctx, 1, attrs)
+		t.metrics.messagePublishLatency.Record(ctx, float64(duration.Milliseconds()), attrs)
+	}
+
+	if t.metricNames.semconv() {
+		attrs := t.messagingAttributes(operationSend, topic, "", success)
+		t.metrics.clientSentMessages.Add(ctx, 1, metric.WithAttributes(attrs...))
+		t.metrics.clientOperationDuration.Record(ctx, duration.Seconds(),
+			metric.WithAttributes(append(attrs, semconv.MessagingOperationTypeSend)...))
+	}
+}
+
+// RecordConsume records the metrics for a consumed message, under the names
+// selected with WithMetricNames. success reports whether the handler
+// processed the message, extra attributes such as the allowlisted baggage are
+// added to both sets.
+func (t *Telemetry) RecordConsume(ctx context.Context, duration time.Duration, topic string, subscription string, success bool, extra ...attribute.KeyValue) {
+	if t.metricNames.legacy() {
+		attrs := metric.WithAttributes(append([]attribute.KeyValue{
+			attribute.String("topic", topic),
+			attribute.String("subscription", subscription),
+		}, extra...)...)
+		t.metrics.messagesConsumed.Add(ctx, 1, attrs)
+		t.metrics.messageConsumeLatency.Record(ctx, float64(duration.Milliseconds()), attrs)
+	}
+
+	if t.metricNames.semconv() {
+		// Delivery succeeded even when the processing failed
+		t.metrics.clientConsumedMessages.Add(ctx, 1,
+			metric.WithAttributes(append(t.messagingAttributes(operationProcess, topic, subscription, true), extra...)...))
+		t.metrics.processDuration.Record(ctx, duration.Seconds(),
+			metric.WithAttributes(append(t.messagingAttributes(operationProcess, topic, subscription, success), extra...)...))
+	}
+}
+
+// messagingAttributes returns the attributes of the semconv messaging
+// metrics, error.type being set for failed operations
+func (t *Telemetry) messagingAttributes(operation string, topic string, subscription string, success bool) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemPulsar,
+		semconv.MessagingOperationName(operation),
+		semconv.MessagingDestinationName(topic),
+	}
+	if subscription != "" {
+		attrs = append(attrs, semconv.MessagingDestinationSubscriptionName(subscription))
+	}
+	attrs = append(attrs, t.serverAttrs...)
+	if !success {
+		attrs = append(attrs, semconv.ErrorTypeOther)
+	}
+	return attrs
+}
+
+// RecordEndToEnd records the latency from the event or publish time of a
+// message to the end of its processing. source tells which of the two
+// timestamps the latency starts from.
+func (t *Telemetry) RecordEndToEnd(ctx context.Context, latency time.Duration, topic string, subscription string, source string, extra ...attribute.KeyValue) {
+	t.metrics.messageEndToEndLatency.Record(ctx, float64(latency.Milliseconds()),
+		metric.WithAttributes(append([]attribute.KeyValue{
+			attribute.String("topic", topic),
+			attribute.String("subscription", subscription),
+			attribute.String("time_source", source),
+		}, extra...)...),
+	)
+}
+
+// RecordCodecError records a payload that could not be encoded or decoded
+func (t *Telemetry) RecordCodecError(ctx context.Context, topic string, operation string, codec string) {
+	t.metrics.codecErrors.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("operation", operation),
+			attribute.String("codec", codec),
+		),
+	)
+}
+
+// RecordContractViolation records a payload not matching its contract.
+// operation is publish or process.
+func (t *Telemetry) RecordContractViolation(ctx context.Context, topic string, operation string, message string, strict bool) {
+	t.metrics.contractViolations.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("operation", operation),
+			attribute.String("message", message),
+			attribute.Bool("strict", strict),
+		),
+	)
+}
+
+// RecordRetry records a failed message scheduled for redelivery
+func (t *Telemetry) RecordRetry(ctx context.Context, topic string, subscription string, attempt int) {
+	t.metrics.messagesRetried.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("subscription", subscription),
+			attribute.Int("attempt", attempt),
+		),
+	)
+}
+
+// RecordDeadLetter records a message routed to the dead letter topic
+func (t *Telemetry) RecordDeadLetter(ctx context.Context, topic string, subscription string) {
+	t.metrics.messagesDeadLettered.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("subscription", subscription),
+		),
+	)
+}
+
+// RecordBusyWorkers tracks the consumer workers processing a message
+func (t *Telemetry) RecordBusyWorkers(ctx context.Context, delta int64, topic string, subscription string) {
+	t.metrics.busyWorkers.Add(ctx, delta,
+		metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("subscription", subscription),
+		),
+	)
+}
+
+// RecordQueueDepth tracks the received messages waiting for a consumer worker
+func (t *Telemetry) RecordQueueDepth(ctx context.Context, delta int64, topic string, subscription string) {
+	t.metrics.queueDepth.Add(ctx, delta,
+		metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("subscription", subscription),
+		),
+	)
+}
+
+// RecordConnectionChange tracks connection state changes
+func (t *Telemetry) RecordConnectionChange(ctx context.Context, deltaConnections int64, host string) {
+	// Record connection change with attributes properly wrapped
+	t.metrics.activePulsarConnections.Add(ctx, deltaConnections,
+		metric.WithAttributes(
+			attribute.String("host", host),
+		),
+	)
+}
+
+// CollectSystemMetrics records CPU and memory usage periodically until ctx is done
+func (t *Telemetry) CollectSystemMetrics(ctx context.Context) {
+	ticker := time.NewTicker(t.systemMetricsInterval)
+	defer ticker.Stop()
+
+	hostAttributes := []attribute.KeyValue{
+		attribute.String("host.name", getHostname()),
+	}
+
+	t.logger.Info("Starting system metrics collection", zap.Duration("interval", t.systemMetricsInterval))
+
+	// Collect metrics immediately on startup, then on ticker
+	t.collectAndRecordMetrics(ctx, hostAttributes)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.collectAndRecordMetrics(ctx, hostAttributes)
+		}
+	}
+}
+
+// Helper function to collect and record metrics
+func (t *Telemetry) collectAndRecordMetrics(ctx context.Context, hostAttributes []attribute.KeyValue) {
+	// Collect CPU usage
+	cpuPercent, err := cpu.Percent(0, false)
+	if err == nil && len(cpuPercent) > 0 {
+		// Convert to ratio (0.0-1.0) as per OpenTelemetry conventions
+		cpuRatio := cpuPercent[0] / 100.0
+		t.metrics.systemCPUUsage.Record(ctx, cpuRatio, metric.WithAttributes(hostAttributes...))
+		t.logger.Info("Recorded CPU usage", zap.Float64("usage_ratio", cpuRatio))
+	} else if err != nil {
+		t.logger.Error("Failed to collect CPU metrics", zap.Error(err))
+	}
+
+	// Collect memory usage
+	memInfo, err := mem.VirtualMemory()
+	if err == nil {
+		// Record memory usage in bytes
+		t.metrics.systemMemoryUsage.Record(ctx, float64(memInfo.Used), metric.WithAttributes(hostAttributes...))
+		t.metrics.systemMemoryTotal.Record(ctx, float64(memInfo.Total), metric.WithAttributes(hostAttributes...))
+		t.logger.Info("Recorded memory metrics",
+			zap.Uint64("used_bytes", memInfo.Used),
+			zap.Uint64("total_bytes", memInfo.Total),
+		)
+	} else {
+		t.logger.Error("Failed to collect memory metrics", zap.Error(err))
+	}
+}
+
+// Get hostname for metric attributes
+func getHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return hostname
+}
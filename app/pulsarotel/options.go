@@ -0,0 +1,304 @@
+package pulsarotel
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultServiceName is the service.name used when none is configured
+	DefaultServiceName = "pulsar-otel-example"
+	// DefaultServiceVersion is the service.version used when none is configured
+	DefaultServiceVersion = "0.1.0"
+	// DefaultEnvironment is the environment resource attribute used when none is configured
+	DefaultEnvironment = "development"
+)
+
+// Option configures the telemetry created by Setup
+type Option func(*options)
+
+type options struct {
+	serviceName    string
+	serviceVersion string
+	environment    string
+	logger         *zap.Logger
+
+	// OTLP exporter settings, a signal is exported to stdout when neither
+	// the base endpoint nor its own endpoint is set
+	otlpProtocol        Protocol
+	otlpEndpoint        string
+	otlpTracesProtocol  Protocol
+	otlpTracesEndpoint  string
+	otlpMetricsProtocol Protocol
+	otlpMetricsEndpoint string
+	otlpLogsProtocol    Protocol
+	otlpLogsEndpoint    string
+	otlpInsecure        bool
+	otlpHeaders         map[string]string
+
+	// prometheus adds a pull reader served by Telemetry.PrometheusHandler
+	prometheus bool
+
+	// Messaging semantic conventions
+	metricNames MetricNames
+	pulsarURL   string
+
+	// propagator is installed as the global text map propagator
+	propagator propagation.TextMapPropagator
+
+	// Sampling
+	sampler                sdktrace.Sampler
+	respectMessageSampling bool
+
+	// exportFailureThreshold is the number of consecutive failed exports of
+	// a signal reported by Telemetry.ExportError
+	exportFailureThreshold int
+
+	// Export and collection tuning
+	batchTimeout          time.Duration
+	maxExportBatchSize    int
+	metricExportInterval  time.Duration
+	metricExportTimeout   time.Duration
+	systemMetricsInterval time.Duration
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		serviceName:    DefaultServiceName,
+		serviceVersion: DefaultServiceVersion,
+		environment:    DefaultEnvironment,
+		logger:         zap.NewNop(),
+		otlpProtocol:   ProtocolGRPC,
+		sampler:        sdktrace.ParentBased(sdktrace.AlwaysSample()),
+		propagator: propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+		// Keep the names existing dashboards and alerts are built on
+		metricNames: MetricNamesLegacy,
+
+		exportFailureThreshold: 3,
+
+		// Set a shorter batch timeout to see spans more quickly
+		batchTimeout:       5 * time.Second,
+		maxExportBatchSize: 10,
+
+		// 15 seconds matches the system metrics collection interval
+		metricExportInterval:  15 * time.Second,
+		metricExportTimeout:   10 * time.Second,
+		systemMetricsInterval: 15 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithServiceName sets the service.name resource attribute and the instrumentation scope name
+func WithServiceName(name string) Option {
+	return func(o *options) {
+		o.serviceName = name
+	}
+}
+
+// WithServiceVersion sets the service.version resource attribute
+func WithServiceVersion(version string) Option {
+	return func(o *options) {
+		o.serviceVersion = version
+	}
+}
+
+// WithEnvironment sets the environment resource attribute
+func WithEnvironment(environment string) Option {
+	return func(o *options) {
+		o.environment = environment
+	}
+}
+
+// WithLogger sets the logger used by the instrumentation, defaults to a no-op
+// logger. Setup bridges it to the OpenTelemetry logs pipeline, see Telemetry.Logger.
+func WithLogger(logger *zap.Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithOTLPEndpoint exports traces, metrics and logs to the given OTLP endpoint
+// instead of stdout. The endpoint is either host:port or a URL; with the
+// HTTP protocol the signal path such as /v1/traces is appended to a URL.
+func WithOTLPEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.otlpEndpoint = endpoint
+	}
+}
+
+// WithProtocol sets the OTLP transport for all signals, defaults to ProtocolGRPC
+func WithProtocol(protocol Protocol) Option {
+	return func(o *options) {
+		o.otlpProtocol = protocol
+	}
+}
+
+// WithTracesEndpoint exports traces to the given endpoint, used as is and
+// taking precedence over WithOTLPEndpoint
+func WithTracesEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.otlpTracesEndpoint = endpoint
+	}
+}
+
+// WithTracesProtocol overrides the OTLP transport for traces
+func WithTracesProtocol(protocol Protocol) Option {
+	return func(o *options) {
+		o.otlpTracesProtocol = protocol
+	}
+}
+
+// WithMetricsEndpoint exports metrics to the given endpoint, used as is and
+// taking precedence over WithOTLPEndpoint
+func WithMetricsEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.otlpMetricsEndpoint = endpoint
+	}
+}
+
+// WithMetricsProtocol overrides the OTLP transport for metrics
+func WithMetricsProtocol(protocol Protocol) Option {
+	return func(o *options) {
+		o.otlpMetricsProtocol = protocol
+	}
+}
+
+// WithInsecure disables TLS for the OTLP exporters
+func WithInsecure(insecure bool) Option {
+	return func(o *options) {
+		o.otlpInsecure = insecure
+	}
+}
+
+// WithHeaders sets additional headers sent with every OTLP export request
+func WithHeaders(headers map[string]string) Option {
+	return func(o *options) {
+		o.otlpHeaders = headers
+	}
+}
+
+// WithPrometheus exposes the metrics for Prometheus scrapes through
+// Telemetry.PrometheusHandler, in addition to the OTLP or stdout push
+func WithPrometheus(enabled bool) Option {
+	return func(o *options) {
+		o.prometheus = enabled
+	}
+}
+
+// WithMetricNames selects the names of the publish and consume metrics, and
+// of the send and process spans and their attributes, defaults to
+// MetricNamesLegacy so that existing dashboards keep working. MetricNamesBoth
+// helps migrating them to MetricNamesSemconv.
+func WithMetricNames(names MetricNames) Option {
+	return func(o *options) {
+		o.metricNames = names
+	}
+}
+
+// WithPulsarURL sets the service URL of the Pulsar client, such as
+// pulsar://localhost:6650, reported as server.address and server.port
+func WithPulsarURL(url string) Option {
+	return func(o *options) {
+		o.pulsarURL = url
+	}
+}
+
+// WithBatchTimeout sets the maximum delay before the span batcher exports
+func WithBatchTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.batchTimeout = timeout
+	}
+}
+
+// WithMaxExportBatchSize sets the maximum number of spans exported in one batch
+func WithMaxExportBatchSize(size int) Option {
+	return func(o *options) {
+		o.maxExportBatchSize = size
+	}
+}
+
+// WithMetricExportInterval sets how often the periodic reader pushes metrics
+func WithMetricExportInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.metricExportInterval = interval
+	}
+}
+
+// WithMetricExportTimeout sets the timeout of a single metric export
+func WithMetricExportTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.metricExportTimeout = timeout
+	}
+}
+
+// WithSystemMetricsInterval sets how often CollectSystemMetrics samples CPU and memory
+func WithSystemMetricsInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.systemMetricsInterval = interval
+	}
+}
+
+// WithLogsEndpoint exports logs to the given endpoint, used as is and
+// taking precedence over WithOTLPEndpoint
+func WithLogsEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.otlpLogsEndpoint = endpoint
+	}
+}
+
+// WithLogsProtocol overrides the OTLP transport for logs
+func WithLogsProtocol(protocol Protocol) Option {
+	return func(o *options) {
+		o.otlpLogsProtocol = protocol
+	}
+}
+
+// WithPropagator sets the propagator injecting and extracting the trace
+// context and baggage in the message properties, defaults to W3C trace
+// context and baggage. Use NewPropagator to build it from OTEL_PROPAGATORS.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(o *options) {
+		if propagator != nil {
+			o.propagator = propagator
+		}
+	}
+}
+
+// WithSampler sets the trace sampler, defaults to parentbased_always_on.
+// Use NewSampler to build it from OTEL_TRACES_SAMPLER values.
+func WithSampler(sampler sdktrace.Sampler) Option {
+	return func(o *options) {
+		if sampler != nil {
+			o.sampler = sampler
+		}
+	}
+}
+
+// WithExportFailureThreshold sets how many exports of a signal must fail in a
+// row before Telemetry.ExportError reports it, defaults to 3
+func WithExportFailureThreshold(threshold int) Option {
+	return func(o *options) {
+		if threshold > 0 {
+			o.exportFailureThreshold = threshold
+		}
+	}
+}
+
+// WithRespectMessageSampling makes consumer process spans follow the sampled
+// flag carried in the message properties instead of the configured sampler
+func WithRespectMessageSampling(respect bool) Option {
+	return func(o *options) {
+		o.respectMessageSampling = respect
+	}
+}
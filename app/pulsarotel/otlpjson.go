@@ -0,0 +1,179 @@
+package pulsarotel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// jsonExportTimeout is the timeout of an http/json export request, the
+// default of the OTLP HTTP exporters
+const jsonExportTimeout = 10 * time.Second
+
+// OTLP JSON fields holding trace and span ids, which the OTLP specification
+// encodes as hex strings rather than the base64 of the protobuf JSON mapping
+var otlpIDFields = map[string]bool{
+	"traceId":      true,
+	"spanId":       true,
+	"parentSpanId": true,
+}
+
+// jsonTransport implements the http/json protocol on top of the OTLP HTTP
+// exporters: it re-encodes their protobuf requests as OTLP JSON and turns a
+// JSON response back into protobuf so that partial successes are reported
+type jsonTransport struct {
+	base http.RoundTripper
+	// newRequest and newResponse return the empty export service messages of
+	// the signal
+	newRequest  func() proto.Message
+	newResponse func() proto.Message
+}
+
+// newJSONClient returns the HTTP client of an exporter using http/json
+func newJSONClient(newRequest, newResponse func() proto.Message) *http.Client {
+	return &http.Client{
+		Timeout: jsonExportTimeout,
+		Transport: jsonTransport{
+			base:        http.DefaultTransport,
+			newRequest:  newRequest,
+			newResponse: newResponse,
+		},
+	}
+}
+
+// RoundTrip sends the request encoded as OTLP JSON
+func (t jsonTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := t.encodeRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("encode OTLP JSON request: %w", err)
+	}
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	out.ContentLength = int64(len(body))
+	out.Header.Set("Content-Type", "application/json")
+	out.Header.Del("Content-Encoding")
+
+	resp, err := t.base.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "application/json" {
+		return resp, nil
+	}
+	return t.decodeResponse(resp)
+}
+
+// encodeRequest reads the protobuf request of the exporter, compressed or
+// not, and returns it as OTLP JSON
+func (t jsonTransport) encodeRequest(req *http.Request) ([]byte, error) {
+	defer req.Body.Close()
+	var r io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	msg := t.newRequest()
+	if err := proto.Unmarshal(raw, msg); err != nil {
+		return nil, err
+	}
+	return marshalOTLPJSON(msg)
+}
+
+// decodeResponse replaces a JSON response body by its protobuf encoding, the
+// only one the exporters read
+func (t jsonTransport) decodeResponse(resp *http.Response) (*http.Response, error) {
+	raw, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+	if len(raw) == 0 {
+		return resp, nil
+	}
+	msg := t.newResponse()
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(raw, msg); err != nil {
+		// The response is left as is, the exporters ignore a JSON body
+		return resp, nil
+	}
+	encoded, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(encoded))
+	resp.ContentLength = int64(len(encoded))
+	resp.Header.Set("Content-Type", "application/x-protobuf")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(encoded)))
+	return resp, nil
+}
+
+// marshalOTLPJSON encodes msg following the OTLP JSON encoding: enums as
+// integers and trace and span ids as hex strings
+func marshalOTLPJSON(msg proto.Message) ([]byte, error) {
+	raw, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if err := hexIDs(doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// hexIDs rewrites the base64 trace and span ids found in doc as hex strings
+func hexIDs(doc any) error {
+	switch v := doc.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if s, ok := value.(string); ok && otlpIDFields[key] {
+				id, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return fmt.Errorf("decode %s: %w", key, err)
+				}
+				v[key] = hex.EncodeToString(id)
+				continue
+			}
+			if err := hexIDs(value); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if err := hexIDs(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package pulsarotel
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// WithWorkers processes messages on n goroutines instead of one at a time
+func WithWorkers(n int) ConsumerOption {
+	return func(c *TracedConsumer) {
+		c.workers = n
+	}
+}
+
+// WithMaxInFlight bounds the number of received messages that are queued or
+// being processed. Run stops receiving while the limit is reached, and never
+// allows fewer in-flight messages than workers.
+func WithMaxInFlight(n int) ConsumerOption {
+	return func(c *TracedConsumer) {
+		c.maxInFlight = n
+	}
+}
+
+// WithKeyOrdering processes messages sharing an ordering key, or a key when
+// no ordering key is set, on the same worker in the order they were
+// received. Messages without a key are spread over all the workers.
+func WithKeyOrdering(enabled bool) ConsumerOption {
+	return func(c *TracedConsumer) {
+		c.keyOrdering = enabled
+	}
+}
+
+// workerPool fans received messages out to the consumer workers. Each worker
+// has its own queue when key ordering is enabled, and all the workers share
+// a single queue otherwise.
+type workerPool struct {
+	consumer *TracedConsumer
+	handler  Handler
+
+	workers int
+	queues  []chan pulsar.Message
+	// slots holds one token per in-flight message, and one for the message
+	// being received
+	slots chan struct{}
+	// dispatched counts the messages queued or being processed
+	dispatched atomic.Int64
+	// dropped counts the messages left unacknowledged once aborted, skipped
+	// in the queue or failed by their cancelled handler
+	dropped atomic.Int64
+	// next spreads messages without a key over the workers
+	next atomic.Uint64
+	wg   sync.WaitGroup
+
+	// handlerCtx outlives the Run context so that in-flight messages are
+	// processed to completion, and is only cancelled by abort
+	handlerCtx     context.Context
+	cancelHandlers context.CancelFunc
+	aborted        atomic.Bool
+	// lastProgress is the UnixNano time a message was last dispatched or processed
+	lastProgress atomic.Int64
+	// done is closed once every worker has returned
+	done chan struct{}
+}
+
+func (c *TracedConsumer) newWorkerPool(ctx context.Context, handler Handler) *workerPool {
+	workers := max(c.workers, 1)
+	maxInFlight := max(c.maxInFlight, workers)
+
+	p := &workerPool{
+		consumer: c,
+		handler:  handler,
+		workers:  workers,
+		slots:    make(chan struct{}, maxInFlight),
+		done:     make(chan struct{}),
+	}
+	p.handlerCtx, p.cancelHandlers = context.WithCancel(context.WithoutCancel(ctx))
+	p.progress()
+
+	queues := 1
+	if c.keyOrdering {
+		queues = workers
+	}
+	for range queues {
+		p.queues = append(p.queues, make(chan pulsar.Message, maxInFlight))
+	}
+	for i := range workers {
+		p.wg.Add(1)
+		go p.work(p.queues[i%queues])
+	}
+	return p
+}
+
+// acquire blocks until a message can be received without exceeding the
+// in-flight limit, and reports false when ctx is done first
+func (p *workerPool) acquire(ctx context.Context) bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release frees the slot taken by acquire
+func (p *workerPool) release() {
+	<-p.slots
+}
+
+// dispatch queues msg for a worker. The caller must hold a slot, so the
+// queue always has room.
+func (p *workerPool) dispatch(ctx context.Context, msg pulsar.Message) {
+	queue := p.queues[0]
+	if len(p.queues) > 1 {
+		queue = p.queues[p.queueIndex(msg)]
+	}
+	p.consumer.tel.RecordQueueDepth(ctx, 1, p.consumer.topic, p.consumer.Subscription())
+	p.dispatched.Add(1)
+	p.progress()
+	queue <- msg
+}
+
+// progress records that the pool is moving messages forward
+func (p *workerPool) progress() {
+	p.lastProgress.Store(time.Now().UnixNano())
+}
+
+// stalled returns an error when messages are in flight but none has been
+// dispatched or processed for longer than threshold. The slot taken while
+// waiting for a message does not count.
+func (p *workerPool) stalled(threshold time.Duration) error {
+	inFlight := p.dispatched.Load()
+	idle := time.Since(time.Unix(0, p.lastProgress.Load()))
+	if inFlight > 0 && idle > threshold {
+		return fmt.Errorf("%d in-flight messages made no progress for %s", inFlight, idle.Round(time.Second))
+	}
+	return nil
+}
+
+// queueIndex returns the queue of the worker that processes the key of msg
+func (p *workerPool) queueIndex(msg pulsar.Message) int {
+	key := msg.OrderingKey()
+	if key == "" {
+		key = msg.Key()
+	}
+	if key == "" {
+		return int(p.next.Add(1) % uint64(len(p.queues)))
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// work processes the messages of queue until it is closed. Once the pool is
+// aborted the remaining messages are skipped without being acknowledged.
+func (p *workerPool) work(queue <-chan pulsar.Message) {
+	defer p.wg.Done()
+
+	c := p.consumer
+	ctx := p.handlerCtx
+	for msg := range queue {
+		c.tel.RecordQueueDepth(ctx, -1, c.topic, c.Subscription())
+		if p.aborted.Load() {
+			p.dropped.Add(1)
+		} else {
+			c.tel.RecordBusyWorkers(ctx, 1, c.topic, c.Subscription())
+			// A handler failing once aborted was cancelled, its message is
+			// nacked or retried rather than acknowledged
+			if err := c.Process(ctx, msg, p.handler); err != nil && p.aborted.Load() {
+				p.dropped.Add(1)
+			}
+			c.tel.RecordBusyWorkers(ctx, -1, c.topic, c.Subscription())
+			p.progress()
+		}
+		p.dispatched.Add(-1)
+		p.release()
+	}
+}
+
+// close stops the workers once they have processed the queued messages
+func (p *workerPool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+	p.cancelHandlers()
+	close(p.done)
+}
+
+// abort cancels the context of the running handlers, makes the workers skip
+// the queued messages and waits up to grace for the workers to return. It
+// returns the number of messages left unacknowledged, counting the ones still
+// being processed when grace elapsed, and whether the workers returned.
+func (p *workerPool) abort(grace time.Duration) (dropped int, stopped bool) {
+	p.aborted.Store(true)
+	p.cancelHandlers()
+	select {
+	case <-p.done:
+		return int(p.dropped.Load()), true
+	case <-time.After(grace):
+		return int(p.dropped.Load() + p.dispatched.Load()), false
+	}
+}
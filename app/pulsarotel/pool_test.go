@@ -0,0 +1,148 @@
+package pulsarotel
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// runConsumer runs consumer with handler until the test ends
+func runConsumer(t *testing.T, consumer *TracedConsumer, handler Handler) {
+	t.Helper()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = consumer.Run(context.Background(), handler)
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, _ = consumer.Shutdown(ctx)
+		<-stopped
+	})
+}
+
+func TestWorkerPoolProcessesKeysInOrder(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	fake := newQueueConsumer()
+	consumer := tel.NewTracedConsumer(fake, "test-topic", WithWorkers(4), WithKeyOrdering(true))
+
+	var (
+		mu      sync.Mutex
+		running = make(map[string]int)
+		seen    = make(map[string][]int)
+	)
+	runConsumer(t, consumer, func(ctx context.Context, msg pulsar.Message) error {
+		m := msg.(keyedMessage)
+		mu.Lock()
+		running[m.key]++
+		if running[m.key] > 1 {
+			t.Errorf("key %s processed by %d workers at once", m.key, running[m.key])
+		}
+		seen[m.key] = append(seen[m.key], m.seq)
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running[m.key]--
+		mu.Unlock()
+		return nil
+	})
+
+	keys := []string{"a", "b", "c"}
+	for seq := range 20 {
+		for _, key := range keys {
+			fake.messages <- keyedMessage{key: key, seq: seq}
+		}
+	}
+	waitFor(t, "every message acknowledged", func() bool { return fake.acked.Load() == 60 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range keys {
+		for i, seq := range seen[key] {
+			if seq != i {
+				t.Errorf("key %s processed in order %v, want the receive order", key, seen[key])
+				break
+			}
+		}
+	}
+}
+
+func TestWorkerPoolBoundsInFlightMessages(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	fake := newQueueConsumer()
+	consumer := tel.NewTracedConsumer(fake, "test-topic", WithWorkers(2), WithMaxInFlight(3))
+
+	release := make(chan struct{})
+	var busy, maxBusy atomic.Int64
+	runConsumer(t, consumer, func(ctx context.Context, msg pulsar.Message) error {
+		n := busy.Add(1)
+		for {
+			if m := maxBusy.Load(); n <= m || maxBusy.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		<-release
+		busy.Add(-1)
+		return nil
+	})
+
+	for seq := range 10 {
+		fake.messages <- keyedMessage{seq: seq}
+	}
+	waitFor(t, "the in-flight limit to be reached", func() bool { return fake.received.Load() == 3 })
+	// Give the consume loop the time to receive more than it may
+	time.Sleep(50 * time.Millisecond)
+	if got := fake.received.Load() - fake.acked.Load(); got != 3 {
+		t.Errorf("%d messages in flight, want the limit of 3", got)
+	}
+
+	close(release)
+	waitFor(t, "every message acknowledged", func() bool { return fake.acked.Load() == 10 })
+	if got := maxBusy.Load(); got > 2 {
+		t.Errorf("%d handlers ran at once, want at most the 2 workers", got)
+	}
+}
+
+func TestWorkerPoolReportsStalledHandler(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	fake := newQueueConsumer()
+	consumer := tel.NewTracedConsumer(fake, "test-topic")
+
+	release := make(chan struct{})
+	runConsumer(t, consumer, func(ctx context.Context, msg pulsar.Message) error {
+		<-release
+		return nil
+	})
+
+	// An idle consumer waiting for messages is not stalled
+	waitFor(t, "the consumer to start", func() bool { return consumer.CheckProgress(0) == nil })
+	time.Sleep(20 * time.Millisecond)
+	if err := consumer.CheckProgress(10 * time.Millisecond); err != nil {
+		t.Errorf("idle consumer CheckProgress() = %v, want no error", err)
+	}
+
+	fake.messages <- keyedMessage{}
+	waitFor(t, "the message to be received", func() bool { return fake.received.Load() == 1 })
+	time.Sleep(20 * time.Millisecond)
+	if err := consumer.CheckProgress(10 * time.Millisecond); err == nil {
+		t.Error("CheckProgress() = nil, want the stuck handler reported")
+	}
+	if err := consumer.CheckProgress(time.Minute); err != nil {
+		t.Errorf("CheckProgress() below the threshold = %v, want no error", err)
+	}
+
+	close(release)
+	waitFor(t, "the message to be acknowledged", func() bool { return fake.acked.Load() == 1 })
+	if err := consumer.CheckProgress(10 * time.Millisecond); err != nil {
+		t.Errorf("CheckProgress() after the handler returned = %v, want no error", err)
+	}
+}
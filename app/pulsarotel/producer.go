@@ -0,0 +1,198 @@
+package pulsarotel
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// TracedProducer wraps a pulsar.Producer so that every Send and SendAsync
+// creates a publish span, injects the trace context into the message
+// properties and records the publish metrics
+type TracedProducer struct {
+	pulsar.Producer
+
+	tel *Telemetry
+	// pending counts the messages sent and not yet acknowledged or failed
+	pending atomic.Int64
+}
+
+var _ pulsar.Producer = (*TracedProducer)(nil)
+
+// NewTracedProducer wraps an existing producer with tracing and metrics
+func (t *Telemetry) NewTracedProducer(producer pulsar.Producer) *TracedProducer {
+	return &TracedProducer{
+		Producer: producer,
+		tel:      t,
+	}
+}
+
+// CreateProducer creates a Pulsar producer inside a create_producer span
+// and wraps it in a TracedProducer
+func (t *Telemetry) CreateProducer(ctx context.Context, client pulsar.Client, opts pulsar.ProducerOptions) (*TracedProducer, error) {
+	// Use messaging semantic conventions
+	ctx, span := t.tracer.Start(ctx, fmt.Sprintf("%s create_producer", opts.Topic),
+		trace.WithAttributes(
+			semconv.MessagingSystemPulsar,
+			semconv.MessagingDestinationName(opts.Topic),
+			attribute.String("pulsar.producer", opts.Name),
+		),
+	)
+	defer span.End()
+
+	t.logger.Info("Creating Pulsar producer",
+		zap.String("topic", opts.Topic),
+		zap.String("producer", opts.Name),
+		ContextField(ctx))
+
+	producer, err := client.CreateProducer(opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return t.NewTracedProducer(producer), nil
+}
+
+// Send publishes a message inside a publish span and blocks until the broker
+// acknowledges it
+func (p *TracedProducer) Send(ctx context.Context, msg *pulsar.ProducerMessage) (pulsar.MessageID, error) {
+	return p.send(ctx, msg, nil)
+}
+
+// SendAsync publishes a message inside a publish span that ends when the
+// broker acknowledges it, just before callback is invoked
+func (p *TracedProducer) SendAsync(ctx context.Context, msg *pulsar.ProducerMessage,
+	callback func(pulsar.MessageID, *pulsar.ProducerMessage, error)) {
+	p.sendAsync(ctx, msg, nil, callback)
+}
+
+// Pending returns the number of messages sent through the producer that the
+// broker has not acknowledged yet, which are lost if the producer is closed
+// before they are flushed
+func (p *TracedProducer) Pending() int64 {
+	return p.pending.Load()
+}
+
+// encodeFunc encodes the payload of a message inside the publish span of ctx
+type encodeFunc func(ctx context.Context) ([]byte, error)
+
+// send implements Send, setting the payload returned by encode when it is
+// not nil
+func (p *TracedProducer) send(ctx context.Context, msg *pulsar.ProducerMessage, encode encodeFunc) (pulsar.MessageID, error) {
+	startTime := time.Now()
+	p.pending.Add(1)
+	ctx, span := p.startPublishSpan(ctx, msg)
+	defer span.End()
+
+	if err := p.encode(ctx, msg, encode); err != nil {
+		p.finishPublish(ctx, span, startTime, nil, err)
+		return nil, err
+	}
+
+	msgID, err := p.Producer.Send(ctx, msg)
+	p.finishPublish(ctx, span, startTime, msgID, err)
+	return msgID, err
+}
+
+// sendAsync implements SendAsync, setting the payload returned by encode
+// when it is not nil
+func (p *TracedProducer) sendAsync(ctx context.Context, msg *pulsar.ProducerMessage, encode encodeFunc,
+	callback func(pulsar.MessageID, *pulsar.ProducerMessage, error)) {
+	startTime := time.Now()
+	p.pending.Add(1)
+	ctx, span := p.startPublishSpan(ctx, msg)
+
+	if err := p.encode(ctx, msg, encode); err != nil {
+		p.finishPublish(ctx, span, startTime, nil, err)
+		span.End()
+		if callback != nil {
+			callback(nil, msg, err)
+		}
+		return
+	}
+
+	p.Producer.SendAsync(ctx, msg, func(msgID pulsar.MessageID, m *pulsar.ProducerMessage, err error) {
+		p.finishPublish(ctx, span, startTime, msgID, err)
+		span.End()
+		if callback != nil {
+			callback(msgID, m, err)
+		}
+	})
+}
+
+// encode sets the payload of msg, failures being recorded on the publish
+// span by finishPublish
+func (p *TracedProducer) encode(ctx context.Context, msg *pulsar.ProducerMessage, encode encodeFunc) error {
+	if encode == nil {
+		return nil
+	}
+	payload, err := encode(ctx)
+	if err != nil {
+		return err
+	}
+	msg.Payload = payload
+	trace.SpanFromContext(ctx).SetAttributes(semconv.MessagingMessageBodySize(len(payload)))
+	return nil
+}
+
+// startPublishSpan starts the send span and injects its context into the
+// message properties
+func (p *TracedProducer) startPublishSpan(ctx context.Context, msg *pulsar.ProducerMessage) (context.Context, trace.Span) {
+	topic := p.Topic()
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemPulsar,
+		semconv.MessagingOperationTypeSend,
+		semconv.MessagingOperationName(operationSend),
+		semconv.MessagingDestinationName(topic),
+		semconv.MessagingClientID(p.Name()),
+	}
+	attrs = append(attrs, p.tel.serverAttrs...)
+	attrs = append(attrs, p.tel.legacySpanAttributes(operationSend, "")...)
+	if id, ok := msg.Properties["message_id"]; ok {
+		attrs = append(attrs, semconv.MessagingMessageID(id))
+	}
+	// A message with a Value is encoded by the client with its schema
+	if msg.Value == nil && msg.Payload != nil {
+		attrs = append(attrs, semconv.MessagingMessageBodySize(len(msg.Payload)))
+	}
+
+	// Span name and kind follow the messaging semantic conventions
+	ctx, span := p.tel.tracer.Start(ctx, p.tel.spanName(operationSend, topic),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrs...),
+	)
+
+	// Ensure trace context is properly injected
+	msg.Properties = InjectTraceContext(ctx, msg.Properties)
+	return ctx, span
+}
+
+// finishPublish records the publish metrics and the outcome on the span
+func (p *TracedProducer) finishPublish(ctx context.Context, span trace.Span, startTime time.Time, msgID pulsar.MessageID, err error) {
+	p.pending.Add(-1)
+	duration := time.Since(startTime)
+	p.tel.RecordPublish(ctx, duration, p.Topic(), err == nil)
+
+	if err != nil {
+		p.tel.logger.Error("Failed to publish message",
+			zap.Error(err),
+			ContextField(ctx))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to publish message")
+		return
+	}
+
+	p.tel.logger.Info("Published message",
+		zap.String("messageID", msgID.String()),
+		ContextField(ctx))
+	span.SetAttributes(attribute.String("pulsar.message_id", msgID.String()))
+}
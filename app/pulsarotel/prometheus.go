@@ -0,0 +1,32 @@
+package pulsarotel
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// newPrometheusReader creates a pull reader exposing the instruments on a
+// dedicated registry, together with the handler serving it. Metric names are
+// translated to the Prometheus conventions, with the unit and _total suffixes,
+// so pulsar.message.publish.latency becomes
+// pulsar_message_publish_latency_milliseconds.
+func newPrometheusReader() (sdkmetric.Reader, http.Handler, error) {
+	registry := prometheus.NewRegistry()
+	reader, err := otelprom.New(otelprom.WithRegisterer(registry))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create Prometheus exporter: %w", err)
+	}
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return reader, handler, nil
+}
+
+// PrometheusHandler returns the handler serving the metrics in the Prometheus
+// exposition format, or nil unless WithPrometheus is enabled
+func (t *Telemetry) PrometheusHandler() http.Handler {
+	return t.prometheusHandler
+}
@@ -0,0 +1,67 @@
+package pulsarotel
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestPrometheusHandlerScrape(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	tel.metricNames = MetricNamesBoth
+	reader, handler, err := newPrometheusReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	if tel.metrics, err = newInstruments(mp.Meter("test")); err != nil {
+		t.Fatal(err)
+	}
+	tel.prometheusHandler = handler
+
+	tel.RecordPublish(context.Background(), 20*time.Millisecond, "test-topic", true)
+
+	rec := httptest.NewRecorder()
+	tel.PrometheusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrape := string(body)
+
+	for _, name := range []string{
+		// Unit suffixes, in the base unit of the metric
+		"pulsar_message_publish_latency_milliseconds_bucket",
+		"messaging_client_operation_duration_seconds_bucket",
+		// Counters end in _total, dots become underscores
+		"pulsar_messages_published_total",
+		"messaging_client_sent_messages_total",
+	} {
+		if !strings.Contains(scrape, name) {
+			t.Errorf("scrape has no %s series", name)
+		}
+	}
+	for _, line := range strings.Split(scrape, "\n") {
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		name := strings.FieldsFunc(line, func(r rune) bool { return r == '{' || r == ' ' })[0]
+		if strings.Contains(name, ".") {
+			t.Errorf("series %s keeps the dots of the OpenTelemetry name", name)
+		}
+		if strings.HasPrefix(name, "go_") || strings.HasPrefix(name, "process_") {
+			t.Errorf("series %s of the Go runtime collectors exposed", name)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package pulsarotel
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Propagator names accepted by NewPropagator, matching the values of OTEL_PROPAGATORS
+const (
+	PropagatorTraceContext = "tracecontext"
+	PropagatorBaggage      = "baggage"
+	PropagatorB3           = "b3"
+	PropagatorB3Multi      = "b3multi"
+	PropagatorJaeger       = "jaeger"
+	PropagatorXRay         = "xray"
+	PropagatorNone         = "none"
+)
+
+// NewPropagator returns the composite propagator for a comma-separated list
+// of propagator names as in OTEL_PROPAGATORS, such as tracecontext,baggage,b3.
+// Every propagator extracts in turn, so messages from producers using any of
+// them keep their trace, and injects its own headers. none disables
+// propagation.
+func NewPropagator(names string) (propagation.TextMapPropagator, error) {
+	var (
+		propagators []propagation.TextMapPropagator
+		seen        []string
+	)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || slices.Contains(seen, name) {
+			continue
+		}
+		seen = append(seen, name)
+
+		switch name {
+		case PropagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case PropagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case PropagatorB3:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case PropagatorB3Multi:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case PropagatorJaeger:
+			propagators = append(propagators, jaeger.Jaeger{})
+		case PropagatorXRay:
+			propagators = append(propagators, xray.Propagator{})
+		case PropagatorNone:
+		default:
+			return nil, fmt.Errorf("unknown propagator %q", name)
+		}
+	}
+	if slices.Contains(seen, PropagatorNone) && len(seen) > 1 {
+		return nil, fmt.Errorf("propagator %q cannot be combined with others", PropagatorNone)
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
+
+// PropagationMode selects how the process span relates to the producer span
+// extracted from the message properties
+type PropagationMode string
+
+const (
+	// PropagationParent makes the process span a child of the producer span,
+	// so that a message is a single trace from publish to processing
+	PropagationParent PropagationMode = "parent"
+	// PropagationLink starts a new trace for the process span with a link to
+	// the producer span, as the messaging semantic conventions advise for
+	// batch processing and messages consumed long after being published
+	PropagationLink PropagationMode = "link"
+)
+
+// WithPropagationMode sets how the process spans relate to the producer
+// spans, defaults to PropagationParent. Baggage is propagated in both modes.
+func WithPropagationMode(mode PropagationMode) ConsumerOption {
+	return func(c *TracedConsumer) {
+		c.propagation = mode
+	}
+}
+
+// InjectTraceContext injects the trace context into the message properties
+func InjectTraceContext(ctx context.Context, properties map[string]string) map[string]string {
+	if properties == nil {
+		properties = make(map[string]string)
+	}
+	// Use the OpenTelemetry propagator to inject trace context
+	otel.GetTextMapPropagator().Inject(ctx, PropertiesCarrier(properties))
+
+	return properties
+}
+
+// ExtractTraceContext extracts the trace context from message properties
+// and returns a new context with the extracted span context
+func ExtractTraceContext(ctx context.Context, properties map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, PropertiesCarrier(properties))
+}
+
+// PropertiesCarrier adapts Pulsar message properties to the TextMapCarrier
+// interface. Property names are case sensitive while propagation headers are
+// not, so Get falls back to a case-insensitive lookup to read the properties
+// written by clients spelling the headers differently, such as X-B3-TraceId.
+type PropertiesCarrier map[string]string
+
+func (c PropertiesCarrier) Get(key string) string {
+	if value, ok := c[key]; ok {
+		return value
+	}
+	for k, value := range c {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+func (c PropertiesCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c PropertiesCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
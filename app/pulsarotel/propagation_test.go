@@ -0,0 +1,181 @@
+package pulsarotel
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// publish starts and ends a producer span on a tracer of its own, as a
+// remote producer would, and returns its span context together with the
+// message properties carrying it
+func publish(t *testing.T, sampled bool) (trace.SpanContext, map[string]string) {
+	t.Helper()
+
+	sampler := sdktrace.NeverSample()
+	if sampled {
+		sampler = sdktrace.AlwaysSample()
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	ctx, span := tp.Tracer("producer").Start(context.Background(), "send test-topic",
+		trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+	return span.SpanContext(), InjectTraceContext(ctx, nil)
+}
+
+func TestProcessPropagationParent(t *testing.T) {
+	tel, recorder := newTestTelemetry(t, sdktrace.AlwaysSample())
+	consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic")
+
+	producer, properties := publish(t, true)
+	var handlerSpan trace.SpanContext
+	err := consumer.Process(context.Background(), fakeMessage{properties: properties},
+		func(ctx context.Context, msg pulsar.Message) error {
+			handlerSpan = trace.SpanContextFromContext(ctx)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	span := processSpan(t, recorder)
+	if got := span.SpanContext().TraceID(); got != producer.TraceID() {
+		t.Errorf("trace ID = %s, want the producer trace %s", got, producer.TraceID())
+	}
+	if got := span.Parent().SpanID(); got != producer.SpanID() {
+		t.Errorf("parent span ID = %s, want the producer span %s", got, producer.SpanID())
+	}
+	if !span.Parent().IsRemote() {
+		t.Error("parent is not remote")
+	}
+	if links := span.Links(); len(links) != 0 {
+		t.Errorf("recorded %d links, want none", len(links))
+	}
+	if !handlerSpan.Equal(span.SpanContext()) {
+		t.Error("handler context does not carry the process span")
+	}
+}
+
+func TestProcessPropagationLink(t *testing.T) {
+	tel, recorder := newTestTelemetry(t, sdktrace.AlwaysSample())
+	consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic", WithPropagationMode(PropagationLink))
+
+	producer, properties := publish(t, true)
+	err := consumer.Process(context.Background(), fakeMessage{properties: properties},
+		func(ctx context.Context, msg pulsar.Message) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	span := processSpan(t, recorder)
+	if span.Parent().IsValid() {
+		t.Errorf("process span has parent %s, want a new root", span.Parent().SpanID())
+	}
+	if got := span.SpanContext().TraceID(); got == producer.TraceID() {
+		t.Error("process span continues the producer trace, want a new trace")
+	}
+	links := span.Links()
+	if len(links) != 1 {
+		t.Fatalf("recorded %d links, want 1", len(links))
+	}
+	if got := links[0].SpanContext; !got.Equal(producer.WithRemote(true)) {
+		t.Errorf("link = %v, want the producer span %v", got, producer)
+	}
+}
+
+func TestProcessPropagationLinkWithoutProducerContext(t *testing.T) {
+	tel, recorder := newTestTelemetry(t, sdktrace.AlwaysSample())
+	consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic", WithPropagationMode(PropagationLink))
+
+	err := consumer.Process(context.Background(), fakeMessage{},
+		func(ctx context.Context, msg pulsar.Message) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	span := processSpan(t, recorder)
+	if span.Parent().IsValid() {
+		t.Error("process span has a parent, want a new root")
+	}
+	if links := span.Links(); len(links) != 0 {
+		t.Errorf("recorded %d links, want none", len(links))
+	}
+}
+
+func TestMessageSamplerFollowsProducer(t *testing.T) {
+	for _, mode := range []PropagationMode{PropagationParent, PropagationLink} {
+		for _, sampled := range []bool{true, false} {
+			// The consumer sampler alone would keep every span, the producer
+			// decision must win either way
+			tel, recorder := newTestTelemetry(t, messageSampler{sampler: sdktrace.AlwaysSample()})
+			consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic", WithPropagationMode(mode))
+
+			_, properties := publish(t, sampled)
+			err := consumer.Process(context.Background(), fakeMessage{properties: properties},
+				func(ctx context.Context, msg pulsar.Message) error { return nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := len(recorder.Ended()) == 1; got != sampled {
+				t.Errorf("%s mode, producer sampled %v: process span recorded = %v", mode, sampled, got)
+			}
+		}
+	}
+}
+
+func TestProcessExtractsCapitalizedB3Headers(t *testing.T) {
+	tel, recorder := newTestTelemetry(t, sdktrace.AlwaysSample())
+	propagator, err := NewPropagator("tracecontext,baggage,b3multi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otel.SetTextMapPropagator(propagator)
+	consumer := tel.NewTracedConsumer(fakeConsumer{}, "test-topic")
+
+	// Properties as written by a producer capitalizing the B3 headers
+	properties := map[string]string{
+		"X-B3-TraceId": "463ac35c9f6413ad48485a3953bb6124",
+		"X-B3-SpanId":  "a2fb4a1d1a96d312",
+		"X-B3-Sampled": "1",
+	}
+	err = consumer.Process(context.Background(), fakeMessage{properties: properties},
+		func(ctx context.Context, msg pulsar.Message) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	span := processSpan(t, recorder)
+	if got := span.Parent().TraceID().String(); got != properties["X-B3-TraceId"] {
+		t.Errorf("trace ID = %s, want the B3 trace %s", got, properties["X-B3-TraceId"])
+	}
+	if got := span.Parent().SpanID().String(); got != properties["X-B3-SpanId"] {
+		t.Errorf("parent span ID = %s, want the B3 span %s", got, properties["X-B3-SpanId"])
+	}
+}
+
+func TestNewPropagator(t *testing.T) {
+	propagator, err := NewPropagator("tracecontext, b3, jaeger, xray, b3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"traceparent", "tracestate", "b3", "uber-trace-id", "X-Amzn-Trace-Id"}
+	for _, field := range want {
+		if !slices.Contains(propagator.Fields(), field) {
+			t.Errorf("fields %v do not contain %s", propagator.Fields(), field)
+		}
+	}
+
+	for _, names := range []string{"tracecontext,zipkin", "none,b3"} {
+		if _, err := NewPropagator(names); err == nil {
+			t.Errorf("NewPropagator(%q) succeeded, want an error", names)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package pulsarotel
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// NewProtoCodec returns a codec encoding the generated protobuf message T
+// with a Pulsar ProtoNative schema, described by the message descriptor
+func NewProtoCodec[T any, PT interface {
+	*T
+	proto.Message
+}]() Codec[T] {
+	schema := pulsar.NewProtoNativeSchemaWithMessage(PT(new(T)), nil)
+	return protoCodec[T, PT]{schemaCodec: schemaCodec[T]{name: CodecProtobuf, schema: schema}}
+}
+
+// protoCodec passes values to the ProtoNative schema as proto.Message
+type protoCodec[T any, PT interface {
+	*T
+	proto.Message
+}] struct {
+	schemaCodec[T]
+}
+
+func (c protoCodec[T, PT]) Encode(value *T) ([]byte, error) {
+	return c.schema.Encode(PT(value))
+}
+
+func (c protoCodec[T, PT]) Decode(data []byte, value *T) error {
+	return c.schema.Decode(data, PT(value))
+}
+
+// NewProtoRecordCodec returns a codec encoding the struct T as protobuf with a
+// Pulsar ProtoNative schema, for payloads that have no generated protobuf
+// type. The protobuf message is derived from the Avro record avroSchemaDef,
+// numbering its fields in declaration order, and the fields of T are mapped
+// with avro struct tags like NewAvroCodec. Only flat records of primitive
+// fields are supported, as declared in async-spec.yml: unions, arrays and
+// nested records are rejected, use NewProtoCodec with a generated type for
+// those payloads.
+func NewProtoRecordCodec[T any](avroSchemaDef string) (Codec[T], error) {
+	if t := reflect.TypeFor[T](); t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("protobuf record codec requires a struct, got %s", t)
+	}
+	schema, err := avro.Parse(avroSchemaDef)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema definition: %w", err)
+	}
+	record, ok := schema.(*avro.RecordSchema)
+	if !ok {
+		return nil, fmt.Errorf("protobuf record codec requires an Avro record, got %s", schema.Type())
+	}
+	descriptor, err := protoDescriptor(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive the protobuf message of %s: %w", record.FullName(), err)
+	}
+	return protoRecordCodec[T]{
+		schemaCodec: schemaCodec[T]{
+			name:   CodecProtobuf,
+			schema: pulsar.NewProtoNativeSchemaWithMessage(dynamicpb.NewMessage(descriptor), nil),
+		},
+		descriptor: descriptor,
+	}, nil
+}
+
+// protoRecordCodec copies values of T to and from dynamic protobuf messages
+type protoRecordCodec[T any] struct {
+	schemaCodec[T]
+
+	descriptor protoreflect.MessageDescriptor
+}
+
+func (c protoRecordCodec[T]) Encode(value *T) ([]byte, error) {
+	msg := dynamicpb.NewMessage(c.descriptor)
+	if err := structToProto(reflect.ValueOf(value).Elem(), msg); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+func (c protoRecordCodec[T]) Decode(data []byte, value *T) error {
+	msg := dynamicpb.NewMessage(c.descriptor)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return err
+	}
+	return protoToStruct(msg, reflect.ValueOf(value).Elem())
+}
+
+// protoDescriptor returns the proto3 message matching record, in the package
+// of the record namespace
+func protoDescriptor(record *avro.RecordSchema) (protoreflect.MessageDescriptor, error) {
+	msg := &descriptorpb.DescriptorProto{Name: proto.String(record.Name())}
+	for i, f := range record.Fields() {
+		primitive, ok := f.Type().(*avro.PrimitiveSchema)
+		if !ok {
+			return nil, fmt.Errorf("field %s: unsupported Avro type %s", f.Name(), f.Type().Type())
+		}
+		typ, ok := protoScalarTypes[primitive.Type()]
+		if !ok {
+			return nil, fmt.Errorf("field %s: unsupported Avro type %s", f.Name(), primitive.Type())
+		}
+		msg.Field = append(msg.Field, &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(f.Name()),
+			JsonName: proto.String(f.Name()),
+			Number:   proto.Int32(int32(i + 1)),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		})
+	}
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String(record.FullName() + ".proto"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{msg},
+	}
+	if record.Namespace() != "" {
+		file.Package = proto.String(record.Namespace())
+	}
+	fd, err := protodesc.NewFile(file, new(protoregistry.Files))
+	if err != nil {
+		return nil, err
+	}
+	return fd.Messages().ByName(protoreflect.Name(record.Name())), nil
+}
+
+// protoScalarTypes maps the Avro primitive types to protobuf scalar types
+var protoScalarTypes = map[avro.Type]descriptorpb.FieldDescriptorProto_Type{
+	avro.String:  descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	avro.Boolean: descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	avro.Int:     descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	avro.Long:    descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	avro.Float:   descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	avro.Double:  descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	avro.Bytes:   descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+}
+
+// avroFieldName returns the Avro field name of a struct field, as hamba/avro
+// maps it
+func avroFieldName(f reflect.StructField) string {
+	if name := f.Tag.Get("avro"); name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// structToProto copies the fields of the struct v to msg
+func structToProto(v reflect.Value, msg protoreflect.Message) error {
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < v.NumField(); i++ {
+		fd := fields.ByName(protoreflect.Name(avroFieldName(v.Type().Field(i))))
+		if fd == nil {
+			continue
+		}
+		value, err := protoScalar(fd, v.Field(i))
+		if err != nil {
+			return fmt.Errorf("%s: %w", msg.Descriptor().Name(), err)
+		}
+		msg.Set(fd, value)
+	}
+	return nil
+}
+
+// protoScalar converts v to the scalar type of fd
+func protoScalar(fd protoreflect.FieldDescriptor, v reflect.Value) (protoreflect.Value, error) {
+	switch kind := fd.Kind(); {
+	case kind == protoreflect.StringKind && v.Kind() == reflect.String:
+		return protoreflect.ValueOfString(v.String()), nil
+	case kind == protoreflect.BoolKind && v.Kind() == reflect.Bool:
+		return protoreflect.ValueOfBool(v.Bool()), nil
+	case kind == protoreflect.Int32Kind && v.CanInt():
+		return protoreflect.ValueOfInt32(int32(v.Int())), nil
+	case kind == protoreflect.Int64Kind && v.CanInt():
+		return protoreflect.ValueOfInt64(v.Int()), nil
+	case kind == protoreflect.FloatKind && v.CanFloat():
+		return protoreflect.ValueOfFloat32(float32(v.Float())), nil
+	case kind == protoreflect.DoubleKind && v.CanFloat():
+		return protoreflect.ValueOfFloat64(v.Float()), nil
+	case kind == protoreflect.BytesKind && v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return protoreflect.ValueOfBytes(v.Bytes()), nil
+	default:
+		return protoreflect.Value{}, fmt.Errorf("field %s: cannot encode %s as %s", fd.Name(), v.Type(), kind)
+	}
+}
+
+// protoToStruct copies the fields of msg to the struct v
+func protoToStruct(msg protoreflect.Message, v reflect.Value) error {
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < v.NumField(); i++ {
+		fd := fields.ByName(protoreflect.Name(avroFieldName(v.Type().Field(i))))
+		if fd == nil {
+			continue
+		}
+		if err := setFromProto(fd, msg.Get(fd), v.Field(i)); err != nil {
+			return fmt.Errorf("%s: %w", msg.Descriptor().Name(), err)
+		}
+	}
+	return nil
+}
+
+// setFromProto sets v to the value of the scalar field fd
+func setFromProto(fd protoreflect.FieldDescriptor, value protoreflect.Value, v reflect.Value) error {
+	switch kind := fd.Kind(); {
+	case kind == protoreflect.StringKind && v.Kind() == reflect.String:
+		v.SetString(value.String())
+	case kind == protoreflect.BoolKind && v.Kind() == reflect.Bool:
+		v.SetBool(value.Bool())
+	case (kind == protoreflect.Int32Kind || kind == protoreflect.Int64Kind) && v.CanInt():
+		v.SetInt(value.Int())
+	case (kind == protoreflect.FloatKind || kind == protoreflect.DoubleKind) && v.CanFloat():
+		v.SetFloat(value.Float())
+	case kind == protoreflect.BytesKind && v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes(value.Bytes())
+	default:
+		return fmt.Errorf("field %s: cannot decode %s into %s", fd.Name(), kind, v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package pulsarotel
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RetryPolicy redelivers messages whose handler fails through the Pulsar
+// retry letter topic with an exponential backoff, and routes them to the
+// dead letter topic once MaxRetries redeliveries have failed
+type RetryPolicy struct {
+	// MaxRetries is the number of redeliveries before a message is
+	// dead-lettered, at least 1 as Pulsar rejects a DLQ policy without
+	// deliveries
+	MaxRetries uint32
+	// InitialBackoff is the delay before the first redelivery, doubled for every following one
+	InitialBackoff time.Duration
+	// MaxBackoff caps the redelivery delay
+	MaxBackoff time.Duration
+	// RetryTopic defaults to <topic>-<subscription>-RETRY
+	RetryTopic string
+	// DeadLetterTopic defaults to <topic>-<subscription>-DLQ
+	DeadLetterTopic string
+}
+
+// dlqPolicy returns the Pulsar DLQ policy matching the retry policy. Pulsar
+// fills in the default topic names when the consumer subscribes.
+func (p *RetryPolicy) dlqPolicy() *pulsar.DLQPolicy {
+	return &pulsar.DLQPolicy{
+		MaxDeliveries:    p.MaxRetries,
+		RetryLetterTopic: p.RetryTopic,
+		DeadLetterTopic:  p.DeadLetterTopic,
+	}
+}
+
+// backoff returns the redelivery delay for the given 1-based attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// reconsumeTimes returns how many times msg has already been redelivered
+// through the retry letter topic
+func reconsumeTimes(msg pulsar.Message) int {
+	n, err := strconv.Atoi(msg.Properties()[pulsar.SysPropertyReconsumeTimes])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// retryOrDeadLetter hands a failed message back to Pulsar for redelivery, or
+// to the dead letter topic once the retries are exhausted, inside a publish
+// span linked to the producer span the message came from. The span context
+// is injected into the redelivered message so the next attempt continues the
+// trace. A permanent failure is dead-lettered without retrying. It reports
+// whether the message was dead-lettered.
+func (c *TracedConsumer) retryOrDeadLetter(ctx context.Context, msg pulsar.Message, producer trace.SpanContext, permanent bool) bool {
+	attempt := reconsumeTimes(msg) + 1
+	deadLetter := permanent || uint32(attempt) > c.retry.MaxRetries
+
+	destination := c.retry.RetryTopic
+	if deadLetter {
+		destination = c.retry.DeadLetterTopic
+	}
+	delay := c.retry.backoff(attempt)
+
+	ctx, span := c.tel.tracer.Start(ctx, c.tel.spanName(operationSend, destination),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithLinks(trace.Link{SpanContext: producer}),
+		trace.WithAttributes(
+			semconv.MessagingSystemPulsar,
+			semconv.MessagingOperationTypeSend,
+			semconv.MessagingOperationName(operationSend),
+			semconv.MessagingDestinationName(destination),
+			attribute.String("pulsar.original_topic", c.topic),
+			attribute.Int("pulsar.retry.attempt", attempt),
+			attribute.Bool("pulsar.dead_letter", deadLetter),
+		),
+		trace.WithAttributes(c.tel.legacySpanAttributes(operationSend, "")...),
+	)
+	defer span.End()
+
+	properties := InjectTraceContext(ctx, nil)
+	if permanent && uint32(attempt) <= c.retry.MaxRetries {
+		// Pulsar picks the dead letter topic once the redeliveries exceed
+		// MaxRetries, so count the message as having used them all
+		properties[pulsar.SysPropertyReconsumeTimes] = strconv.Itoa(int(c.retry.MaxRetries))
+		if _, ok := msg.Properties()[pulsar.SysPropertyRealTopic]; !ok {
+			properties[pulsar.SysPropertyRealTopic] = msg.Topic()
+			properties[pulsar.SysPropertyOriginMessageID] = msg.ID().String()
+		}
+	}
+	c.ReconsumeLaterWithCustomProperties(msg, properties, delay)
+
+	if deadLetter {
+		c.tel.RecordDeadLetter(ctx, c.topic, c.Subscription())
+		c.tel.logger.Warn("Message dead-lettered",
+			zap.String("messageID", msg.ID().String()),
+			zap.String("dead_letter_topic", destination),
+			zap.Int("attempts", attempt),
+			ContextField(ctx))
+		return true
+	}
+
+	c.tel.RecordRetry(ctx, c.topic, c.Subscription(), attempt)
+	c.tel.logger.Info("Message scheduled for retry",
+		zap.String("messageID", msg.ID().String()),
+		zap.String("retry_topic", destination),
+		zap.Int("attempt", attempt),
+		zap.Duration("delay", delay),
+		ContextField(ctx))
+	return false
+}
@@ -0,0 +1,118 @@
+package pulsarotel
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// reconsumeCall is a message handed back to Pulsar for redelivery
+type reconsumeCall struct {
+	properties map[string]string
+	delay      time.Duration
+}
+
+// retryConsumer is a fakeConsumer recording the messages reconsumed later
+type retryConsumer struct {
+	fakeConsumer
+
+	calls []reconsumeCall
+}
+
+func (c *retryConsumer) ReconsumeLaterWithCustomProperties(_ pulsar.Message, properties map[string]string, delay time.Duration) {
+	c.calls = append(c.calls, reconsumeCall{properties: properties, delay: delay})
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{6, 10 * time.Second},
+		// Far attempts must neither overflow nor exceed the cap
+		{100, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestProcessRetriesThenDeadLetters(t *testing.T) {
+	tel, recorder := newTestTelemetry(t, sdktrace.AlwaysSample())
+	reader := recordMetrics(t, tel)
+	fake := &retryConsumer{}
+	consumer := tel.NewTracedConsumer(fake, "test-topic", WithRetryPolicy(RetryPolicy{
+		MaxRetries:      2,
+		InitialBackoff:  time.Second,
+		MaxBackoff:      time.Minute,
+		RetryTopic:      "test-topic-RETRY",
+		DeadLetterTopic: "test-topic-DLQ",
+	}))
+
+	failing := func(ctx context.Context, msg pulsar.Message) error { return errors.New("boom") }
+	wantSpans := []string{"send test-topic-RETRY", "send test-topic-RETRY", "send test-topic-DLQ"}
+	wantDelays := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	for redeliveries := range 3 {
+		recorder.Reset()
+		msg := fakeMessage{properties: map[string]string{
+			pulsar.SysPropertyReconsumeTimes: strconv.Itoa(redeliveries),
+		}}
+		if err := consumer.Process(context.Background(), msg, failing); err == nil {
+			t.Fatal("Process returned no error, want the handler error")
+		}
+
+		call := fake.calls[len(fake.calls)-1]
+		if call.delay != wantDelays[redeliveries] {
+			t.Errorf("attempt %d delay = %s, want %s", redeliveries+1, call.delay, wantDelays[redeliveries])
+		}
+		if call.properties["traceparent"] == "" {
+			t.Errorf("attempt %d redelivered without trace context", redeliveries+1)
+		}
+		var sendSpan sdktrace.ReadOnlySpan
+		for _, span := range recorder.Ended() {
+			if span.Name() != "process test-topic" {
+				sendSpan = span
+			}
+		}
+		if sendSpan == nil || sendSpan.Name() != wantSpans[redeliveries] {
+			t.Errorf("attempt %d send span = %v, want %s", redeliveries+1, sendSpan, wantSpans[redeliveries])
+		}
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		retried, _ := int64Value(t, reader, "pulsar.messages.retried",
+			attribute.String("topic", "test-topic"),
+			attribute.String("subscription", "test-subscription"),
+			attribute.Int("attempt", attempt))
+		if retried != 1 {
+			t.Errorf("pulsar.messages.retried for attempt %d = %d, want 1", attempt, retried)
+		}
+	}
+	retried, _ := int64Value(t, reader, "pulsar.messages.retried",
+		attribute.String("topic", "test-topic"),
+		attribute.String("subscription", "test-subscription"),
+		attribute.Int("attempt", 3))
+	if retried != 0 {
+		t.Errorf("pulsar.messages.retried for attempt 3 = %d, want the message dead-lettered instead", retried)
+	}
+	deadLettered, _ := int64Value(t, reader, "pulsar.messages.dead_lettered",
+		attribute.String("topic", "test-topic"),
+		attribute.String("subscription", "test-subscription"))
+	if deadLettered != 1 {
+		t.Errorf("pulsar.messages.dead_lettered = %d, want 1", deadLettered)
+	}
+}
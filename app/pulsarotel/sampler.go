@@ -0,0 +1,98 @@
+package pulsarotel
+
+import (
+	"fmt"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Sampler names accepted by NewSampler, matching the values of OTEL_TRACES_SAMPLER
+const (
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIDRatio            = "traceidratio"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+)
+
+// NewSampler returns the sampler named as in OTEL_TRACES_SAMPLER. The ratio
+// is the OTEL_TRACES_SAMPLER_ARG value and is only used by the traceidratio
+// samplers, which reject a ratio outside of 0 to 1.
+func NewSampler(name string, ratio float64) (sdktrace.Sampler, error) {
+	if (name == SamplerTraceIDRatio || name == SamplerParentBasedTraceIDRatio) && !(ratio >= 0 && ratio <= 1) {
+		return nil, fmt.Errorf("sampler %s ratio %v must be between 0 and 1", name, ratio)
+	}
+	switch name {
+	case SamplerAlwaysOn:
+		return sdktrace.AlwaysSample(), nil
+	case SamplerAlwaysOff:
+		return sdktrace.NeverSample(), nil
+	case SamplerTraceIDRatio:
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case SamplerParentBasedAlwaysOn:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case SamplerParentBasedAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case SamplerParentBasedTraceIDRatio:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	default:
+		return nil, fmt.Errorf("unknown sampler %q", name)
+	}
+}
+
+// messageSampler makes process spans follow the sampled flag that the
+// producer propagated in the message properties, so that publish and process
+// spans of a message are either both kept or both dropped whatever sampler
+// the consumer runs. With PropagationLink the flag is read from the link to
+// the producer span. Every other span is delegated to the wrapped sampler.
+type messageSampler struct {
+	sampler sdktrace.Sampler
+}
+
+func (s messageSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if !isProcessSpan(p) {
+		return s.sampler.ShouldSample(p)
+	}
+
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	tracestate := psc.TraceState()
+	if !psc.IsValid() {
+		// A new root linked to the producer span keeps its own trace state
+		if len(p.Links) == 0 {
+			return s.sampler.ShouldSample(p)
+		}
+		psc = p.Links[0].SpanContext
+	}
+	if !psc.IsValid() || !psc.IsRemote() {
+		return s.sampler.ShouldSample(p)
+	}
+
+	decision := sdktrace.Drop
+	if psc.IsSampled() {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: tracestate,
+	}
+}
+
+func (s messageSampler) Description() string {
+	return fmt.Sprintf("MessageSampler{%s}", s.sampler.Description())
+}
+
+// isProcessSpan reports whether the span being sampled is a consumer process span
+func isProcessSpan(p sdktrace.SamplingParameters) bool {
+	if p.Kind != trace.SpanKindConsumer {
+		return false
+	}
+	for _, attr := range p.Attributes {
+		if attr == semconv.MessagingOperationTypeProcess {
+			return true
+		}
+	}
+	return false
+}
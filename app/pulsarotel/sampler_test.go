@@ -0,0 +1,55 @@
+package pulsarotel
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		name            string
+		ratio           float64
+		wantDescription string
+		wantErr         bool
+	}{
+		{name: SamplerAlwaysOn, wantDescription: "AlwaysOnSampler"},
+		{name: SamplerAlwaysOff, wantDescription: "AlwaysOffSampler"},
+		{name: SamplerTraceIDRatio, ratio: 0.25, wantDescription: "TraceIDRatioBased{0.25}"},
+		{
+			name:            SamplerParentBasedAlwaysOn,
+			wantDescription: "ParentBased{root:AlwaysOnSampler,remoteParentSampled:AlwaysOnSampler,remoteParentNotSampled:AlwaysOffSampler,localParentSampled:AlwaysOnSampler,localParentNotSampled:AlwaysOffSampler}",
+		},
+		{
+			name:            SamplerParentBasedAlwaysOff,
+			wantDescription: "ParentBased{root:AlwaysOffSampler,remoteParentSampled:AlwaysOnSampler,remoteParentNotSampled:AlwaysOffSampler,localParentSampled:AlwaysOnSampler,localParentNotSampled:AlwaysOffSampler}",
+		},
+		{
+			name:            SamplerParentBasedTraceIDRatio,
+			ratio:           0.5,
+			wantDescription: "ParentBased{root:TraceIDRatioBased{0.5},remoteParentSampled:AlwaysOnSampler,remoteParentNotSampled:AlwaysOffSampler,localParentSampled:AlwaysOnSampler,localParentNotSampled:AlwaysOffSampler}",
+		},
+		// The ratio is ignored by the samplers that do not use it
+		{name: SamplerAlwaysOn, ratio: 2, wantDescription: "AlwaysOnSampler"},
+		{name: SamplerTraceIDRatio, ratio: 1.5, wantErr: true},
+		{name: SamplerTraceIDRatio, ratio: -0.1, wantErr: true},
+		{name: SamplerParentBasedTraceIDRatio, ratio: math.NaN(), wantErr: true},
+		{name: "ratio", wantErr: true},
+		{name: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		sampler, err := NewSampler(tt.name, tt.ratio)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewSampler(%q, %v) = %s, want an error", tt.name, tt.ratio, sampler.Description())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewSampler(%q, %v) error = %v", tt.name, tt.ratio, err)
+			continue
+		}
+		if got := sampler.Description(); got != tt.wantDescription {
+			t.Errorf("NewSampler(%q, %v) = %s, want %s", tt.name, tt.ratio, got, tt.wantDescription)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package pulsarotel
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// MetricNames selects the names under which the publish and consume metrics
+// are recorded, and likewise the names and attributes of the send and process
+// spans
+type MetricNames string
+
+const (
+	// MetricNamesSemconv records the messaging.client.sent.messages,
+	// messaging.client.consumed.messages, messaging.client.operation.duration
+	// and messaging.process.duration metrics of the semantic conventions
+	MetricNamesSemconv MetricNames = "semconv"
+	// MetricNamesLegacy records the pulsar.messages.published,
+	// pulsar.messages.consumed, pulsar.message.publish.latency and
+	// pulsar.message.consume.latency metrics
+	MetricNamesLegacy MetricNames = "legacy"
+	// MetricNamesBoth records both sets of metrics
+	MetricNamesBoth MetricNames = "both"
+)
+
+func (n MetricNames) semconv() bool {
+	return n == MetricNamesSemconv || n == MetricNamesBoth
+}
+
+func (n MetricNames) legacy() bool {
+	return n == MetricNamesLegacy || n == MetricNamesBoth
+}
+
+// Messaging operation names of the spans and semconv metrics
+const (
+	operationSend    = "send"
+	operationProcess = "process"
+)
+
+// legacyOperations maps the operation names to the messaging.operation values
+// of the spans recorded before the stable semantic conventions
+var legacyOperations = map[string]string{
+	operationSend:    "publish",
+	operationProcess: "process",
+}
+
+// spanName returns the name of the span of operation on destination, as in
+// send my-topic, or my-topic publish with MetricNamesLegacy
+func (t *Telemetry) spanName(operation string, destination string) string {
+	if t.metricNames.legacy() && !t.metricNames.semconv() {
+		return destination + " " + legacyOperations[operation]
+	}
+	return operation + " " + destination
+}
+
+// legacySpanAttributes returns the messaging.operation and
+// pulsar.subscription attributes that the spans carried before the stable
+// semantic conventions, with MetricNamesLegacy and MetricNamesBoth only. The
+// subscription is omitted when empty.
+func (t *Telemetry) legacySpanAttributes(operation string, subscription string) []attribute.KeyValue {
+	if !t.metricNames.legacy() {
+		return nil
+	}
+	attrs := []attribute.KeyValue{attribute.String("messaging.operation", legacyOperations[operation])}
+	if subscription != "" {
+		attrs = append(attrs, attribute.String("pulsar.subscription", subscription))
+	}
+	return attrs
+}
+
+// serverAttributes returns server.address and server.port for the first
+// host of the Pulsar service URL, or nothing when it cannot be parsed
+func serverAttributes(serviceURL string) []attribute.KeyValue {
+	if serviceURL == "" {
+		return nil
+	}
+	u, err := url.Parse(serviceURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	// A service URL may list several brokers, as in pulsar://a:6650,b:6650
+	hostPort, _, _ := strings.Cut(u.Host, ",")
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return []attribute.KeyValue{semconv.ServerAddress(hostPort)}
+	}
+	attrs := []attribute.KeyValue{semconv.ServerAddress(host)}
+	if port, err := strconv.Atoi(portStr); err == nil {
+		attrs = append(attrs, semconv.ServerPort(port))
+	}
+	return attrs
+}
@@ -0,0 +1,161 @@
+// Package pulsarotel instruments Apache Pulsar producers and consumers with
+// OpenTelemetry traces, metrics and logs.
+package pulsarotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Telemetry holds the tracer, meter and logger providers together with the
+// instruments used by the Pulsar instrumentation
+type Telemetry struct {
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+	loggerProvider *sdklog.LoggerProvider
+
+	tracer  trace.Tracer
+	metrics *instruments
+	logger  *zap.Logger
+	health  *exportHealth
+
+	metricNames MetricNames
+	serverAttrs []attribute.KeyValue
+
+	prometheusHandler     http.Handler
+	systemMetricsInterval time.Duration
+}
+
+// Setup initializes the tracer, meter and logger providers, registers them
+// as the global providers and creates the metric instruments
+func Setup(ctx context.Context, opts ...Option) (*Telemetry, error) {
+	o := newOptions(opts)
+
+	res, err := newResource(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	health := &exportHealth{threshold: o.exportFailureThreshold}
+	tp, err := newTracerProvider(ctx, res, o, health)
+	if err != nil {
+		return nil, err
+	}
+
+	mp, promHandler, err := newMeterProvider(ctx, res, o, health)
+	if err != nil {
+		_ = tp.Shutdown(ctx)
+		return nil, err
+	}
+
+	lp, err := newLoggerProvider(ctx, res, o, health)
+	if err != nil {
+		_ = tp.Shutdown(ctx)
+		_ = mp.Shutdown(ctx)
+		return nil, err
+	}
+
+	metrics, err := newInstruments(mp.Meter(o.serviceName))
+	if err != nil {
+		_ = tp.Shutdown(ctx)
+		_ = mp.Shutdown(ctx)
+		_ = lp.Shutdown(ctx)
+		return nil, err
+	}
+
+	// Set the global providers and propagator
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	global.SetLoggerProvider(lp)
+	otel.SetTextMapPropagator(o.propagator)
+
+	return &Telemetry{
+		tracerProvider: tp,
+		meterProvider:  mp,
+		loggerProvider: lp,
+		tracer:         tp.Tracer(o.serviceName),
+		metrics:        metrics,
+		logger:         newBridgedLogger(o.logger, lp, o.serviceName),
+		health:         health,
+		metricNames:    o.metricNames,
+		serverAttrs:    serverAttributes(o.pulsarURL),
+
+		prometheusHandler:     promHandler,
+		systemMetricsInterval: o.systemMetricsInterval,
+	}, nil
+}
+
+// Tracer returns the tracer used for Pulsar spans
+func (t *Telemetry) Tracer() trace.Tracer {
+	return t.tracer
+}
+
+// Logger returns the logger configured with WithLogger, bridged to the
+// OpenTelemetry logs pipeline. Add ContextField to an entry to correlate it
+// with the active span.
+func (t *Telemetry) Logger() *zap.Logger {
+	return t.logger
+}
+
+// Shutdown flushes and stops the tracer, meter and logger providers
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	var errs []error
+	if err := t.tracerProvider.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to shut down tracer provider: %w", err))
+	}
+	if err := t.meterProvider.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to shut down meter provider: %w", err))
+	}
+	if err := t.loggerProvider.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to shut down logger provider: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// ForceFlush exports the spans, metrics and log records buffered by the
+// providers without shutting them down
+func (t *Telemetry) ForceFlush(ctx context.Context) error {
+	var errs []error
+	if err := t.tracerProvider.ForceFlush(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to flush tracer provider: %w", err))
+	}
+	if err := t.meterProvider.ForceFlush(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to flush meter provider: %w", err))
+	}
+	if err := t.loggerProvider.ForceFlush(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to flush logger provider: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// newResource creates a resource describing the service
+func newResource(ctx context.Context, o *options) (*resource.Resource, error) {
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithFromEnv(),
+		resource.WithAttributes(
+			// These attributes are added if not present in the environment
+			semconv.ServiceName(o.serviceName),
+			semconv.ServiceVersion(o.serviceVersion),
+			attribute.String("environment", o.environment),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+	return res, nil
+}
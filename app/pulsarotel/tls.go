@@ -0,0 +1,270 @@
+package pulsarotel
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// Certificate kinds recorded in the certificate attribute of the TLS metrics
+const (
+	certificateClient = "client"
+	certificateTrust  = "trust"
+)
+
+// CertificateReloader supplies the client certificate of a mutual TLS
+// connection to Pulsar and reloads it when its files change on disk, so that
+// rotated certificates are used without a restart. Pulsar reads the
+// certificate, and the trusted CA file, whenever it opens a connection:
+// established connections keep their certificate until they reconnect.
+//
+// Run also records the time left until the client and trusted certificates
+// expire in pulsar.tls.certificate.expiry.
+type CertificateReloader struct {
+	tel            *Telemetry
+	trustCertsFile string
+	certFile       string
+	keyFile        string
+	interval       time.Duration
+
+	mu          sync.RWMutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// CertificateOption configures a CertificateReloader
+type CertificateOption func(*CertificateReloader)
+
+// WithTrustCertsFile sets the trusted CA file whose expiry is recorded
+// alongside the one of the client certificate
+func WithTrustCertsFile(path string) CertificateOption {
+	return func(r *CertificateReloader) {
+		r.trustCertsFile = path
+	}
+}
+
+// WithReloadInterval sets how often Run checks the certificate files
+func WithReloadInterval(interval time.Duration) CertificateOption {
+	return func(r *CertificateReloader) {
+		if interval > 0 {
+			r.interval = interval
+		}
+	}
+}
+
+// NewCertificateReloader loads the client certificate and private key from
+// certFile and keyFile, PEM encoded. Both may be empty to only record the
+// expiry of the trusted certificates.
+func (t *Telemetry) NewCertificateReloader(certFile, keyFile string, opts ...CertificateOption) (*CertificateReloader, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("the client certificate and private key files must be set together")
+	}
+	r := &CertificateReloader{
+		tel:      t,
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	if r.trustCertsFile != "" {
+		if _, err := earliestExpiry(r.trustCertsFile); err != nil {
+			return nil, fmt.Errorf("failed to read trusted certificates: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// Authentication returns the Pulsar TLS authentication presenting the
+// current client certificate
+func (r *CertificateReloader) Authentication() pulsar.Authentication {
+	return pulsar.NewAuthenticationFromTLSCertSupplier(r.ClientCertificate)
+}
+
+// ClientCertificate returns the current client certificate, nil when no
+// certificate is configured
+func (r *CertificateReloader) ClientCertificate() (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a TLS configuration trusting the CA file and presenting
+// the current client certificate, for the HTTPS calls made next to the Pulsar
+// connection such as the admin API ones. The trusted certificates are read
+// once, when TLSConfig is called.
+func (r *CertificateReloader) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := r.ClientCertificate()
+			if cert == nil {
+				// An empty certificate sends none
+				return &tls.Certificate{}, err
+			}
+			return cert, err
+		},
+	}
+	if r.trustCertsFile != "" {
+		data, err := os.ReadFile(r.trustCertsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trusted certificates: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", r.trustCertsFile)
+		}
+	}
+	return config, nil
+}
+
+// Run checks the certificate files periodically, reloads the client
+// certificate when they changed and records the certificate expiry, until
+// ctx is done
+func (r *CertificateReloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.tel.logger.Info("Watching TLS certificates",
+		zap.String("cert_file", r.certFile),
+		zap.String("trust_certs_file", r.trustCertsFile),
+		zap.Duration("interval", r.interval))
+
+	for {
+		r.recordExpiry(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if reloaded, err := r.Reload(); err != nil {
+			// Keep presenting the previous certificate, a rotation may be
+			// half written
+			r.tel.logger.Warn("Failed to reload client certificate", zap.Error(err))
+			r.tel.recordCertificateReload(ctx, r.certFile, false)
+		} else if reloaded {
+			r.tel.logger.Info("Reloaded client certificate", zap.String("cert_file", r.certFile))
+			r.tel.recordCertificateReload(ctx, r.certFile, true)
+		}
+	}
+}
+
+// Reload loads the client certificate again when its certificate or key file
+// was modified since the last load, and reports whether it did
+func (r *CertificateReloader) Reload() (bool, error) {
+	if r.certFile == "" {
+		return false, nil
+	}
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read client certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read client private key: %w", err)
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && certInfo.ModTime().Equal(r.certModTime) && keyInfo.ModTime().Equal(r.keyModTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.certModTime = certInfo.ModTime()
+	r.keyModTime = keyInfo.ModTime()
+	r.mu.Unlock()
+	return true, nil
+}
+
+// recordExpiry records the time left until the client certificate and the
+// earliest trusted certificate expire
+func (r *CertificateReloader) recordExpiry(ctx context.Context) {
+	if cert, _ := r.ClientCertificate(); cert != nil && cert.Leaf != nil {
+		r.tel.recordCertificateExpiry(ctx, certificateClient, r.certFile, cert.Leaf.NotAfter)
+	}
+	if r.trustCertsFile == "" {
+		return
+	}
+	notAfter, err := earliestExpiry(r.trustCertsFile)
+	if err != nil {
+		r.tel.logger.Warn("Failed to read trusted certificates", zap.Error(err))
+		return
+	}
+	r.tel.recordCertificateExpiry(ctx, certificateTrust, r.trustCertsFile, notAfter)
+}
+
+// earliestExpiry returns the earliest expiry of the PEM certificates in path
+func earliestExpiry(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var notAfter time.Time
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid certificate in %s: %w", path, err)
+		}
+		if notAfter.IsZero() || cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+	if notAfter.IsZero() {
+		return time.Time{}, fmt.Errorf("no certificate found in %s", path)
+	}
+	return notAfter, nil
+}
+
+// recordCertificateExpiry records the seconds left until notAfter, negative
+// once the certificate expired
+func (t *Telemetry) recordCertificateExpiry(ctx context.Context, kind string, file string, notAfter time.Time) {
+	t.metrics.certificateExpiry.Record(ctx, time.Until(notAfter).Seconds(),
+		metric.WithAttributes(
+			attribute.String("certificate", kind),
+			attribute.String("file", file),
+		),
+	)
+}
+
+// recordCertificateReload records an attempt to load a rotated client
+// certificate
+func (t *Telemetry) recordCertificateReload(ctx context.Context, file string, success bool) {
+	t.metrics.certificateReloads.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("certificate", certificateClient),
+			attribute.String("file", file),
+			attribute.Bool("success", success),
+		),
+	)
+}
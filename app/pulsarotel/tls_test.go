@@ -0,0 +1,209 @@
+package pulsarotel
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// writeCertificate writes a self-signed certificate with serial, expiring
+// after validity, and its private key to certFile and keyFile, and sets their
+// modification time to modTime
+func writeCertificate(t *testing.T, certFile, keyFile string, serial int64, validity time.Duration, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, certFile, "CERTIFICATE", der, modTime)
+	writePEM(t, keyFile, "PRIVATE KEY", keyDER, modTime)
+}
+
+// writePEM writes der as a PEM block to path, modified at modTime
+func writePEM(t *testing.T, path, blockType string, der []byte, modTime time.Time) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// clientSerial returns the serial number of the client certificate config
+// presents
+func clientSerial(t *testing.T, config *tls.Config) int64 {
+	t.Helper()
+
+	cert, err := config.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertificateReloaderRotation(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	modTime := time.Now().Add(-time.Hour)
+	writeCertificate(t, certFile, keyFile, 1, 24*time.Hour, modTime)
+
+	r, err := tel.NewCertificateReloader(certFile, keyFile, WithTrustCertsFile(certFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The configuration follows the rotations
+	config, err := r.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.RootCAs == nil {
+		t.Error("TLSConfig() does not trust the CA file")
+	}
+	if got := clientSerial(t, config); got != 1 {
+		t.Fatalf("client certificate serial = %d, want 1", got)
+	}
+
+	// Unchanged files are not loaded again
+	if reloaded, err := r.Reload(); reloaded || err != nil {
+		t.Errorf("Reload() of unchanged files = %v, %v, want false, nil", reloaded, err)
+	}
+
+	// A rotation is detected from the modification time
+	writeCertificate(t, certFile, keyFile, 2, 24*time.Hour, modTime.Add(time.Minute))
+	if reloaded, err := r.Reload(); !reloaded || err != nil {
+		t.Errorf("Reload() of rotated files = %v, %v, want true, nil", reloaded, err)
+	}
+	if got := clientSerial(t, config); got != 2 {
+		t.Errorf("client certificate serial = %d, want the rotated 2", got)
+	}
+
+	// A half written rotation keeps the last good certificate
+	writePEM(t, certFile, "CERTIFICATE", []byte("truncated"), modTime.Add(2*time.Minute))
+	if reloaded, err := r.Reload(); reloaded || err == nil {
+		t.Errorf("Reload() of an invalid certificate = %v, %v, want false and an error", reloaded, err)
+	}
+	if got := clientSerial(t, config); got != 2 {
+		t.Errorf("client certificate serial = %d, want the last good 2", got)
+	}
+}
+
+func TestCertificateReloaderMetrics(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.NeverSample())
+	reader := recordMetrics(t, tel)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	modTime := time.Now().Add(-time.Hour)
+	writeCertificate(t, certFile, keyFile, 1, 24*time.Hour, modTime)
+
+	r, err := tel.NewCertificateReloader(certFile, keyFile, WithReloadInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		r.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	expiry := func() (float64, bool) {
+		return float64Value(t, reader, "pulsar.tls.certificate.expiry",
+			attribute.String("certificate", "client"), attribute.String("file", certFile))
+	}
+	waitFor(t, "the certificate expiry to be recorded", func() bool {
+		_, ok := expiry()
+		return ok
+	})
+	if seconds, _ := expiry(); seconds <= 23*3600 || seconds > 24*3600 {
+		t.Errorf("pulsar.tls.certificate.expiry = %v, want about a day", seconds)
+	}
+
+	reloads := func(success bool) int64 {
+		n, _ := int64Value(t, reader, "pulsar.tls.certificate.reloads",
+			attribute.String("certificate", "client"),
+			attribute.String("file", certFile),
+			attribute.Bool("success", success))
+		return n
+	}
+	writeCertificate(t, certFile, keyFile, 2, time.Hour, modTime.Add(time.Minute))
+	waitFor(t, "the rotated certificate to be reloaded", func() bool { return reloads(true) == 1 })
+	waitFor(t, "the expiry of the rotated certificate", func() bool {
+		seconds, _ := expiry()
+		return seconds <= 3600
+	})
+
+	writePEM(t, certFile, "CERTIFICATE", []byte("truncated"), modTime.Add(2*time.Minute))
+	waitFor(t, "the failed reload to be counted", func() bool { return reloads(false) > 0 })
+	if got := reloads(true); got != 1 {
+		t.Errorf("%d successful reloads, want 1", got)
+	}
+}
+
+// float64Value returns the value of the float64 gauge name recorded with
+// attrs, and whether it was recorded
+func float64Value(t *testing.T, reader *sdkmetric.ManualReader, name string, attrs ...attribute.KeyValue) (float64, bool) {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	want := attribute.NewSet(attrs...)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			gauge, ok := m.Data.(metricdata.Gauge[float64])
+			if m.Name != name || !ok {
+				continue
+			}
+			for _, point := range gauge.DataPoints {
+				if point.Attributes.Equals(&want) {
+					return point.Value, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
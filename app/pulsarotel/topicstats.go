@@ -0,0 +1,259 @@
+package pulsarotel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// TopicStats is the subset of the Pulsar topic statistics recorded as gauges
+type TopicStats struct {
+	// MsgBacklog is the number of messages of the subscription not yet acknowledged
+	MsgBacklog int64
+	// MsgRateIn is the rate of messages published on the topic, per second
+	MsgRateIn float64
+	// MsgRateOut is the rate of messages dispatched to all the subscriptions, per second
+	MsgRateOut float64
+	// StorageSize is the size of the topic in bytes
+	StorageSize int64
+	// Consumers is the number of consumers connected to the subscription
+	Consumers int
+	// Subscribed reports whether the subscription exists; MsgBacklog and
+	// Consumers are zero and their gauges not recorded otherwise
+	Subscribed bool
+}
+
+// TopicStatsCollector periodically polls the Pulsar admin REST API for the
+// statistics of a topic and optionally one of its subscriptions, and records
+// them as gauges. Partitioned topics are aggregated over their partitions.
+type TopicStatsCollector struct {
+	tel          *Telemetry
+	baseURL      string
+	topic        string
+	subscription string
+	topicPath    string
+
+	client   *http.Client
+	token    func() (string, error)
+	interval time.Duration
+}
+
+// TopicStatsOption configures a TopicStatsCollector
+type TopicStatsOption func(*TopicStatsCollector)
+
+// WithStatsHTTPClient sets the HTTP client used to call the admin API
+func WithStatsHTTPClient(client *http.Client) TopicStatsOption {
+	return func(c *TopicStatsCollector) {
+		c.client = client
+	}
+}
+
+// WithStatsAuthToken authenticates the admin API calls with a bearer token
+func WithStatsAuthToken(token string) TopicStatsOption {
+	return func(c *TopicStatsCollector) {
+		if token != "" {
+			c.token = func() (string, error) { return token, nil }
+		}
+	}
+}
+
+// WithStatsTokenSupplier authenticates the admin API calls with the bearer
+// token returned by token for every call, such as the Token method of an
+// OAuth2TokenSource or a FileTokenSource
+func WithStatsTokenSupplier(token func() (string, error)) TopicStatsOption {
+	return func(c *TopicStatsCollector) {
+		c.token = token
+	}
+}
+
+// WithStatsInterval sets how often Run polls the admin API
+func WithStatsInterval(interval time.Duration) TopicStatsOption {
+	return func(c *TopicStatsCollector) {
+		c.interval = interval
+	}
+}
+
+// NewTopicStatsCollector creates a collector for topic and subscription
+// polling the admin API at baseURL, such as http://localhost:8080. The topic
+// is either a full persistent:// or non-persistent:// name, a
+// tenant/namespace/topic name or a short name in public/default. An empty
+// subscription records the topic gauges only, as when no consumer runs.
+func (t *Telemetry) NewTopicStatsCollector(baseURL, topic, subscription string, opts ...TopicStatsOption) (*TopicStatsCollector, error) {
+	path, err := topicPath(topic)
+	if err != nil {
+		return nil, err
+	}
+	c := &TopicStatsCollector{
+		tel:          t,
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		topic:        topic,
+		subscription: subscription,
+		topicPath:    path,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		interval:     30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// topicPath returns the admin API path of topic, as in
+// persistent/public/default/my-topic
+func topicPath(topic string) (string, error) {
+	domain, name := "persistent", topic
+	if before, after, ok := strings.Cut(topic, "://"); ok {
+		domain, name = before, after
+	}
+	parts := strings.Split(name, "/")
+	switch len(parts) {
+	case 1:
+		parts = []string{"public", "default", parts[0]}
+	case 3:
+	default:
+		return "", fmt.Errorf("invalid topic name %q", topic)
+	}
+	for i, part := range parts {
+		if part == "" {
+			return "", fmt.Errorf("invalid topic name %q", topic)
+		}
+		parts[i] = url.PathEscape(part)
+	}
+	return domain + "/" + strings.Join(parts, "/"), nil
+}
+
+// Run records the topic statistics periodically until ctx is done
+func (c *TopicStatsCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	c.tel.logger.Info("Starting topic stats collection",
+		zap.String("admin_url", c.baseURL),
+		zap.String("topic", c.topic),
+		zap.String("subscription", c.subscription),
+		zap.Duration("interval", c.interval))
+
+	// Collect stats immediately on startup, then on ticker
+	for {
+		if _, err := c.Collect(ctx); err != nil && ctx.Err() == nil {
+			c.tel.logger.Warn("Failed to collect topic stats", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect polls the admin API once, records the gauges and returns the
+// statistics
+func (c *TopicStatsCollector) Collect(ctx context.Context) (*TopicStats, error) {
+	var partitions struct {
+		Partitions int `json:"partitions"`
+	}
+	if err := c.get(ctx, "/admin/v2/"+c.topicPath+"/partitions", &partitions); err != nil {
+		return nil, err
+	}
+
+	statsPath := "/admin/v2/" + c.topicPath + "/stats"
+	if partitions.Partitions > 0 {
+		statsPath = "/admin/v2/" + c.topicPath + "/partitioned-stats?perPartition=false"
+	}
+	var resp topicStatsResponse
+	if err := c.get(ctx, statsPath, &resp); err != nil {
+		return nil, err
+	}
+
+	stats := &TopicStats{
+		MsgRateIn:   resp.MsgRateIn,
+		MsgRateOut:  resp.MsgRateOut,
+		StorageSize: resp.StorageSize,
+	}
+	if c.subscription != "" {
+		// A subscription missing from the response has no backlog to report,
+		// recording zero would hide that it does not exist
+		if sub, ok := resp.Subscriptions[c.subscription]; ok {
+			stats.MsgBacklog = sub.MsgBacklog
+			stats.Consumers = len(sub.Consumers)
+			stats.Subscribed = true
+		} else {
+			c.tel.logger.Warn("Subscription not found in topic stats",
+				zap.String("topic", c.topic),
+				zap.String("subscription", c.subscription))
+		}
+	}
+	c.tel.recordTopicStats(ctx, c.topic, c.subscription, stats)
+	return stats, nil
+}
+
+// topicStatsResponse is the part of the stats and partitioned-stats
+// responses read by Collect
+type topicStatsResponse struct {
+	MsgRateIn     float64 `json:"msgRateIn"`
+	MsgRateOut    float64 `json:"msgRateOut"`
+	StorageSize   int64   `json:"storageSize"`
+	Subscriptions map[string]struct {
+		MsgBacklog int64             `json:"msgBacklog"`
+		Consumers  []json.RawMessage `json:"consumers"`
+	} `json:"subscriptions"`
+}
+
+// get calls the admin API and decodes the JSON response into v
+func (c *TopicStatsCollector) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != nil {
+		token, err := c.token()
+		if err != nil {
+			return fmt.Errorf("failed to get Pulsar admin API token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Pulsar admin API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pulsar admin API %s returned %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode Pulsar admin API response: %w", err)
+	}
+	return nil
+}
+
+// recordTopicStats records the topic statistics gauges, and the subscription
+// ones when the subscription exists
+func (t *Telemetry) recordTopicStats(ctx context.Context, topic string, subscription string, stats *TopicStats) {
+	topicAttributes := metric.WithAttributes(
+		attribute.String("topic", topic),
+	)
+	if stats.Subscribed {
+		subscriptionAttributes := metric.WithAttributes(
+			attribute.String("topic", topic),
+			attribute.String("subscription", subscription),
+		)
+		t.metrics.subscriptionBacklog.Record(ctx, stats.MsgBacklog, subscriptionAttributes)
+		t.metrics.subscriptionConsumers.Record(ctx, int64(stats.Consumers), subscriptionAttributes)
+	}
+	t.metrics.topicMsgRateIn.Record(ctx, stats.MsgRateIn, topicAttributes)
+	t.metrics.topicMsgRateOut.Record(ctx, stats.MsgRateOut, topicAttributes)
+	t.metrics.topicStorageSize.Record(ctx, stats.StorageSize, topicAttributes)
+}
@@ -0,0 +1,189 @@
+package pulsarotel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// stubAdminAPI is a Pulsar admin API serving the stats of my-topic, with
+// partitions partitions, and recording the requests it receives
+type stubAdminAPI struct {
+	*httptest.Server
+
+	partitions int
+	status     int
+	requests   []string
+	tokens     []string
+}
+
+func newStubAdminAPI(t *testing.T, partitions int) *stubAdminAPI {
+	t.Helper()
+
+	api := &stubAdminAPI{partitions: partitions, status: http.StatusOK}
+	const stats = `{"msgRateIn":12.5,"msgRateOut":10,"storageSize":2048,` +
+		`"subscriptions":{"my-subscription":{"msgBacklog":42,"consumers":[{},{}]},` +
+		`"other-subscription":{"msgBacklog":7,"consumers":[{}]}}}`
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.requests = append(api.requests, r.URL.RequestURI())
+		api.tokens = append(api.tokens, r.Header.Get("Authorization"))
+		if api.status != http.StatusOK {
+			http.Error(w, "Topic not found", api.status)
+			return
+		}
+		switch r.URL.Path {
+		case "/admin/v2/persistent/public/default/my-topic/partitions":
+			_, _ = fmt.Fprintf(w, `{"partitions":%d}`, api.partitions)
+		case "/admin/v2/persistent/public/default/my-topic/stats",
+			"/admin/v2/persistent/public/default/my-topic/partitioned-stats":
+			_, _ = w.Write([]byte(stats))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+func TestTopicStatsCollectorRecordsStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		partitions int
+		statsURI   string
+	}{
+		{"non-partitioned", 0, "/admin/v2/persistent/public/default/my-topic/stats"},
+		{"partitioned", 3, "/admin/v2/persistent/public/default/my-topic/partitioned-stats?perPartition=false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+			reader := recordMetrics(t, tel)
+			api := newStubAdminAPI(t, tt.partitions)
+
+			collector, err := tel.NewTopicStatsCollector(api.URL, "my-topic", "my-subscription")
+			if err != nil {
+				t.Fatal(err)
+			}
+			stats, err := collector.Collect(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantRequests := []string{"/admin/v2/persistent/public/default/my-topic/partitions", tt.statsURI}
+			if strings.Join(api.requests, " ") != strings.Join(wantRequests, " ") {
+				t.Errorf("requests = %v, want %v", api.requests, wantRequests)
+			}
+			if stats.MsgBacklog != 42 || stats.Consumers != 2 || stats.MsgRateIn != 12.5 || stats.StorageSize != 2048 {
+				t.Errorf("stats = %+v, want the stats of my-subscription", stats)
+			}
+
+			attrs := []attribute.KeyValue{
+				attribute.String("topic", "my-topic"),
+				attribute.String("subscription", "my-subscription"),
+			}
+			if backlog, _ := int64Value(t, reader, "pulsar.subscription.backlog", attrs...); backlog != 42 {
+				t.Errorf("pulsar.subscription.backlog = %d, want 42", backlog)
+			}
+			if consumers, _ := int64Value(t, reader, "pulsar.subscription.consumers", attrs...); consumers != 2 {
+				t.Errorf("pulsar.subscription.consumers = %d, want 2", consumers)
+			}
+		})
+	}
+}
+
+func TestTopicStatsCollectorSendsToken(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+	api := newStubAdminAPI(t, 0)
+
+	calls := 0
+	collector, err := tel.NewTopicStatsCollector(api.URL, "my-topic", "my-subscription",
+		WithStatsTokenSupplier(func() (string, error) {
+			calls++
+			return "secret", nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collector.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.tokens) != 2 {
+		t.Fatalf("admin API received %d requests, want 2", len(api.tokens))
+	}
+	for _, token := range api.tokens {
+		if token != "Bearer secret" {
+			t.Errorf("Authorization = %q, want %q", token, "Bearer secret")
+		}
+	}
+	if calls != len(api.requests) {
+		t.Errorf("token supplier called %d times for %d requests, want once per request", calls, len(api.requests))
+	}
+}
+
+func TestTopicStatsCollectorReturnsHTTPErrors(t *testing.T) {
+	tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+	reader := recordMetrics(t, tel)
+	api := newStubAdminAPI(t, 0)
+	api.status = http.StatusNotFound
+
+	collector, err := tel.NewTopicStatsCollector(api.URL, "my-topic", "my-subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = collector.Collect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("Collect error = %v, want the 404 response", err)
+	}
+	if _, ok := int64Value(t, reader, "pulsar.subscription.backlog",
+		attribute.String("topic", "my-topic"),
+		attribute.String("subscription", "my-subscription")); ok {
+		t.Error("pulsar.subscription.backlog recorded after a failed call")
+	}
+}
+
+func TestTopicStatsCollectorSkipsMissingSubscription(t *testing.T) {
+	tests := []struct {
+		name         string
+		subscription string
+	}{
+		{"unknown subscription", "gone-subscription"},
+		{"no subscription", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tel, _ := newTestTelemetry(t, sdktrace.AlwaysSample())
+			reader := recordMetrics(t, tel)
+			api := newStubAdminAPI(t, 0)
+
+			collector, err := tel.NewTopicStatsCollector(api.URL, "my-topic", tt.subscription)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stats, err := collector.Collect(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Subscribed || stats.MsgBacklog != 0 || stats.Consumers != 0 {
+				t.Errorf("stats = %+v, want no subscription stats", stats)
+			}
+			if storage, _ := int64Value(t, reader, "pulsar.topic.storage.size",
+				attribute.String("topic", "my-topic")); storage != 2048 {
+				t.Errorf("pulsar.topic.storage.size = %d, want 2048", storage)
+			}
+			for _, name := range []string{"pulsar.subscription.backlog", "pulsar.subscription.consumers"} {
+				if _, ok := int64Value(t, reader, name,
+					attribute.String("topic", "my-topic"),
+					attribute.String("subscription", tt.subscription)); ok {
+					t.Errorf("%s recorded for a missing subscription", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package pulsarotel
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+)
+
+// newTracerProvider creates a tracer provider exporting to OTLP when an
+// endpoint is configured and to stdout otherwise
+func newTracerProvider(ctx context.Context, res *resource.Resource, o *options, health *exportHealth) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	if signal := o.resolveSignal(o.otlpTracesEndpoint, o.otlpTracesProtocol, tracesPath); signal.endpoint != "" {
+		// Create the OTLP exporter for the configured protocol
+		exporter, err = newOTLPSpanExporter(ctx, signal, o)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+		o.logger.Info("Using OTLP exporter",
+			zap.String("endpoint", signal.endpoint),
+			zap.String("protocol", string(signal.protocol)),
+		)
+	} else {
+		// Fall back to stdout exporter
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		o.logger.Info("Using stdout exporter")
+	}
+
+	sampler := o.sampler
+	if o.respectMessageSampling {
+		sampler = messageSampler{sampler: sampler}
+	}
+	o.logger.Info("Using trace sampler", zap.String("sampler", sampler.Description()))
+
+	// Create trace provider with the exporter
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(healthSpanExporter{SpanExporter: exporter, health: health},
+			sdktrace.WithBatchTimeout(o.batchTimeout),
+			sdktrace.WithMaxExportBatchSize(o.maxExportBatchSize),
+		),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	)
+	return tp, nil
+}